@@ -0,0 +1,463 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/diff"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/languages"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/schema"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// commonFlags are accepted by every command that reads a config.
+type commonFlags struct {
+	config    string
+	templates string
+	jobs      int
+	out       string
+}
+
+func newFlagSet(name string, common *commonFlags) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&common.config, "config", "config.yaml", "Path to YAML configuration file")
+	flags.StringVar(&common.templates, "templates", "", "Directory of templates overriding the built-in ones")
+	flags.StringVar(&common.out, "out", ".", "Directory the generated files are written to")
+	flags.IntVar(&common.jobs, "jobs", 0, "Number of files to render at once (0 means one per CPU)")
+	return flags
+}
+
+// parseFlags parses args, returning an exit code when the command should
+// stop: exitOK after -h, exitUsage on bad flags.
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected argument %q\n", flags.Name(), flags.Arg(0))
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+func fail(code int, format string, args ...any) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return code
+}
+
+// failErr reports err under what, one line per error when several were
+// joined together.
+func failErr(code int, what string, err error) int {
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) == 1 {
+		return fail(code, "%s: %v", what, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s:\n", what)
+	for _, line := range lines {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+	return code
+}
+
+// loadConfig parses and validates the config, printing each diagnostic.
+func loadConfig(path string) (*types.Config, int) {
+	cfg, err := codegen.ParseConfig(path)
+	if err != nil {
+		var diags codegen.Diagnostics
+		if errors.As(err, &diags) {
+			for _, diag := range diags {
+				fmt.Fprintln(os.Stderr, diag)
+			}
+			return nil, fail(exitInvalid, "%d problem(s) in %s", len(diags), path)
+		}
+		return nil, fail(exitInvalid, "Failed to parse config file: %v", err)
+	}
+	return cfg, exitOK
+}
+
+// render generates into memory, carrying over protected regions from disk.
+// With force, regions that are no longer generated are dropped.
+func render(cfg *types.Config, common commonFlags, force bool) (*output.MemorySink, error) {
+	generated := output.NewMemorySink()
+	opts := codegen.Options{
+		TemplateDir: common.templates,
+		Output:      generated,
+		Preserve:    common.out,
+		Workers:     common.jobs,
+		Force:       force,
+	}
+	if err := codegen.NewGenerator(cfg, opts).Generate(); err != nil {
+		return nil, err
+	}
+	return generated, nil
+}
+
+func runGenerate(args []string) int {
+	var common commonFlags
+	flags := newFlagSet("generate", &common)
+	archive := flags.String("archive", "", "Write the generated files to stdout as a \"zip\" or \"tar\" archive")
+	dryRun := flags.Bool("dry-run", false, "List the files that would be created or changed without writing them")
+	prune := flags.Bool("prune", false, "Remove files the previous run generated that are no longer generated")
+	force := flags.Bool("force", false, "Discard hand-written code: drop protected regions that are no longer generated and, with -prune, remove edited files")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if *prune && *archive != "" {
+		return fail(exitUsage, "generate: -prune cannot be combined with -archive")
+	}
+
+	cfg, code := loadConfig(common.config)
+	if cfg == nil {
+		return code
+	}
+
+	// Read the previous manifest before generating replaces it
+	var previous *codegen.Manifest
+	if *prune {
+		var err error
+		if previous, err = codegen.ReadManifest(common.out, cfg); err != nil {
+			return fail(exitFailed, "Failed to read manifest: %v", err)
+		}
+	}
+
+	if *dryRun {
+		return compare(cfg, common, false, previous, *force)
+	}
+
+	opts := codegen.Options{
+		TemplateDir: common.templates,
+		Output:      output.NewDirSink(common.out),
+		Preserve:    common.out,
+		Workers:     common.jobs,
+		Force:       *force,
+	}
+
+	// Stream an archive to stdout instead of writing to disk
+	var sink output.ArchiveSink
+	if *archive != "" {
+		var err error
+		if sink, err = output.NewArchiveSink(*archive, os.Stdout); err != nil {
+			return fail(exitUsage, "%v", err)
+		}
+		opts.Output = sink
+	}
+
+	if err := codegen.NewGenerator(cfg, opts).Generate(); err != nil {
+		return failErr(exitFailed, "Failed to generate code", err)
+	}
+
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			return fail(exitFailed, "Failed to write archive: %v", err)
+		}
+		return exitOK
+	}
+
+	code = exitOK
+	if previous != nil {
+		current, err := codegen.ReadManifest(common.out, cfg)
+		if err != nil {
+			return fail(exitFailed, "Failed to read manifest: %v", err)
+		}
+		var kept []string
+		code, kept = removeGenerated(common.out, previous, previous.Orphans(current), nil, *force, false)
+
+		// Keep recording the edited orphans left on disk, so a later
+		// clean can still find them
+		if len(kept) > 0 {
+			current.Carry(previous, kept)
+			if err := codegen.WriteManifest(common.out, cfg, current); err != nil {
+				return fail(exitFailed, "Failed to write manifest: %v", err)
+			}
+		}
+	}
+
+	fmt.Println("Code generation completed successfully!")
+	return code
+}
+
+func runDiff(args []string) int {
+	var common commonFlags
+	flags := newFlagSet("diff", &common)
+	force := flags.Bool("force", false, "Show the diff with protected regions that are no longer generated dropped, as generate -force would")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	cfg, code := loadConfig(common.config)
+	if cfg == nil {
+		return code
+	}
+	return compare(cfg, common, true, nil, *force)
+}
+
+// compare renders into memory and compares the result with the files on
+// disk, printing either the changed paths or a unified diff. Files in
+// previous that are no longer generated are listed as removed, unless
+// they were edited and force is not set. Force also lets protected
+// regions that are no longer generated be dropped.
+func compare(cfg *types.Config, common commonFlags, unified bool, previous *codegen.Manifest, force bool) int {
+	generated, err := render(cfg, common, force)
+	if err != nil {
+		return failErr(exitFailed, "Failed to generate code", err)
+	}
+
+	// The manifest hashes the config and every file, so it changes with
+	// any hand edit to a protected region; it is not generated code
+	changes, err := codegen.Compare(generated, common.out, codegen.ManifestPath(cfg))
+	if err != nil {
+		return fail(exitFailed, "Failed to compare generated code: %v", err)
+	}
+
+	for _, change := range changes {
+		if unified {
+			oldName := "a/" + change.Path
+			if change.Kind == codegen.Create {
+				oldName = "/dev/null"
+			}
+			fmt.Print(diff.Unified(oldName, "b/"+change.Path, string(change.Old), string(change.New)))
+		} else {
+			fmt.Printf("%s %s\n", change.Kind, change.Path)
+		}
+	}
+
+	removed := 0
+	if previous != nil {
+		current, err := codegen.NewManifest(cfg, generated)
+		if err != nil {
+			return fail(exitFailed, "Failed to build manifest: %v", err)
+		}
+		for _, name := range previous.Orphans(current) {
+			state, err := previous.State(common.out, name)
+			if err != nil {
+				return fail(exitFailed, "Failed to read %s: %v", name, err)
+			}
+			switch {
+			case state == codegen.Missing:
+			case state == codegen.Edited && !force:
+				fmt.Fprintf(os.Stderr, "skipping %s: edited since it was generated (use -force)\n", name)
+			default:
+				fmt.Printf("remove %s\n", name)
+				removed++
+			}
+		}
+	}
+
+	if len(changes) > 0 || removed > 0 {
+		return exitChanged
+	}
+	return exitOK
+}
+
+func runValidate(args []string) int {
+	var common commonFlags
+	flags := newFlagSet("validate", &common)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if cfg, code := loadConfig(common.config); cfg == nil {
+		return code
+	}
+	fmt.Printf("%s is valid\n", common.config)
+	return exitOK
+}
+
+func runClean(args []string) int {
+	var common commonFlags
+	flags := newFlagSet("clean", &common)
+	dryRun := flags.Bool("dry-run", false, "List the files that would be removed without removing them")
+	force := flags.Bool("force", false, "Also remove generated files that were edited by hand")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	cfg, code := loadConfig(common.config)
+	if cfg == nil {
+		return code
+	}
+	manifest, err := codegen.ReadManifest(common.out, cfg)
+	if err != nil {
+		return fail(exitFailed, "Failed to read manifest: %v", err)
+	}
+	if manifest == nil {
+		fmt.Printf("Nothing to clean: %s not found\n", codegen.ManifestPath(cfg))
+		return exitOK
+	}
+
+	code, _ = removeGenerated(common.out, manifest, manifest.Names(), manifest.Dirs, *force, *dryRun)
+	if code != exitOK {
+		// Keep the manifest so a later clean -force can still tell
+		// which of the remaining files were generated
+		return code
+	}
+
+	name := codegen.ManifestPath(cfg)
+	fmt.Printf("remove %s\n", name)
+	if *dryRun {
+		return exitOK
+	}
+	if err := os.Remove(filepath.Join(common.out, filepath.FromSlash(name))); err != nil {
+		return fail(exitFailed, "Failed to remove %s: %v", name, err)
+	}
+	removeEmptyDirs(common.out, manifest.Dirs, []string{name})
+	return exitOK
+}
+
+// removeGenerated deletes the files in names below root, all recorded in
+// manifest, along with any of dirs left empty. Files edited since they
+// were generated are kept unless force is set, and returned.
+func removeGenerated(root string, manifest *codegen.Manifest, names, dirs []string, force, dryRun bool) (int, []string) {
+	code := exitOK
+	var removed, kept []string
+	for _, name := range names {
+		state, err := manifest.State(root, name)
+		if err != nil {
+			return fail(exitFailed, "Failed to read %s: %v", name, err), kept
+		}
+		if state == codegen.Missing {
+			continue
+		}
+		if state == codegen.Edited && !force {
+			fmt.Fprintf(os.Stderr, "skipping %s: edited since it was generated (use -force)\n", name)
+			code = exitFailed
+			kept = append(kept, name)
+			continue
+		}
+		fmt.Printf("remove %s\n", name)
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			return fail(exitFailed, "Failed to remove %s: %v", name, err), kept
+		}
+		removed = append(removed, name)
+	}
+
+	if !dryRun {
+		removeEmptyDirs(root, dirs, removed)
+	}
+	return code, kept
+}
+
+// removeEmptyDirs removes the generated directories below root, deepest
+// first, as long as nothing else is left in them.
+func removeEmptyDirs(root string, dirs, files []string) {
+	seen := map[string]bool{}
+	for _, name := range append(dirs, files...) {
+		for dir := filepath.Dir(filepath.FromSlash(name)); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			seen[dir] = true
+		}
+		if contains(dirs, name) {
+			seen[filepath.FromSlash(name)] = true
+		}
+	}
+	all := make([]string, 0, len(seen))
+	for dir := range seen {
+		all = append(all, dir)
+	}
+	sort.Slice(all, func(i, j int) bool { return len(all[i]) > len(all[j]) })
+	for _, dir := range all {
+		os.Remove(filepath.Join(root, dir)) // fails harmlessly unless empty
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func runInit(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	config := flags.String("config", "config.yaml", "Path of the config file to write")
+	language := flags.String("language", "c", "Target language of the starter config")
+	project := flags.String("project", "myproject", "Project name of the starter config")
+	force := flags.Bool("force", false, "Overwrite an existing config file")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if _, ok := languages.Lookup(*language); !ok {
+		return fail(exitUsage, "unsupported language: %s", *language)
+	}
+	if _, err := os.Stat(*config); err == nil && !*force {
+		return fail(exitFailed, "%s already exists (use -force to overwrite)", *config)
+	}
+
+	content := strings.NewReplacer("{{language}}", *language, "{{project}}", *project).Replace(starterConfig)
+	if err := os.WriteFile(*config, []byte(content), 0644); err != nil {
+		return fail(exitFailed, "Failed to write %s: %v", *config, err)
+	}
+	fmt.Printf("Wrote %s\n", *config)
+	return exitOK
+}
+
+const starterConfig = `language: {{language}}
+projectName: {{project}}
+types:
+  - name: Point
+    fields:
+      - name: x
+        type: double
+      - name: y
+        type: double
+    methods:
+      - name: distanceTo
+        parameters:
+          - name: other
+            type: Point
+        returnType: double
+
+files:
+  - name: geometry
+    functions:
+      - name: centroid
+        parameters:
+          - name: points
+            type: list<Point>
+        returnType: Point
+`
+
+func runLanguages(args []string) int {
+	flags := flag.NewFlagSet("languages", flag.ContinueOnError)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	for _, backend := range languages.Backends() {
+		if len(backend.Aliases) > 0 {
+			fmt.Printf("%s (%s)\n", backend.Name, strings.Join(backend.Aliases, ", "))
+		} else {
+			fmt.Println(backend.Name)
+		}
+	}
+	return exitOK
+}
+
+func runSchema(args []string) int {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	data, err := schema.JSON()
+	if err != nil {
+		return fail(exitFailed, "Failed to build schema: %v", err)
+	}
+	os.Stdout.Write(data)
+	return exitOK
+}
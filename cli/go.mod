@@ -1,3 +1,5 @@
 module github.com/kvnbanunu/melke-playground/cli
 
 go 1.23.5
+
+require github.com/goccy/go-yaml v1.19.2
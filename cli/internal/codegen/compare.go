@@ -0,0 +1,61 @@
+package codegen
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
+)
+
+type ChangeKind int
+
+const (
+	Create ChangeKind = iota
+	Update
+)
+
+func (k ChangeKind) String() string {
+	if k == Create {
+		return "create"
+	}
+	return "update"
+}
+
+// Change is a generated file that differs from what is on disk.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  []byte
+	New  []byte
+}
+
+// Compare reports every file in generated that is missing from, or
+// different to, the same path below root. Unchanged files and the files
+// named in ignore are omitted.
+func Compare(generated *output.MemorySink, root string, ignore ...string) ([]Change, error) {
+	skip := map[string]bool{}
+	for _, name := range ignore {
+		skip[name] = true
+	}
+
+	var changes []Change
+	for _, name := range generated.Files() {
+		if skip[name] {
+			continue
+		}
+		data, _ := generated.File(name)
+		existing, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			changes = append(changes, Change{Path: name, Kind: Create, New: data})
+		case err != nil:
+			return nil, err
+		case !bytes.Equal(existing, data):
+			changes = append(changes, Change{Path: name, Kind: Update, Old: existing, New: data})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,231 @@
+// Package diff produces unified diffs between two texts.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	a, b int // line indexes in the old and new text
+}
+
+// Unified returns a unified diff turning oldText into newText, or an
+// empty string when they are equal. oldName and newName label the
+// "---" and "+++" header lines.
+func Unified(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	a, b := splitLines(oldText), splitLines(newText)
+	ops := edits(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != opEqual {
+				end = i + 1
+				continue
+			}
+			if i-end >= 2*context {
+				break
+			}
+		}
+		lo := max(start-context, 0)
+		hi := min(end+context, len(ops))
+		writeHunk(&sb, a, b, ops[lo:hi])
+		start = hi
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, a, b []string, ops []op) {
+	var oldStart, oldCount, newStart, newCount int
+	oldStart, newStart = -1, -1
+	for _, o := range ops {
+		if o.kind != opInsert {
+			if oldStart < 0 {
+				oldStart = o.a
+			}
+			oldCount++
+		}
+		if o.kind != opDelete {
+			if newStart < 0 {
+				newStart = o.b
+			}
+			newCount++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n",
+		hunkRange(oldStart, oldCount, ops[0].a),
+		hunkRange(newStart, newCount, ops[0].b))
+
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			writeLine(sb, ' ', a[o.a])
+		case opDelete:
+			writeLine(sb, '-', a[o.a])
+		case opInsert:
+			writeLine(sb, '+', b[o.b])
+		}
+	}
+}
+
+// hunkRange formats a "start,count" pair using 1-based line numbers.
+// An empty range refers to the line before position pos.
+func hunkRange(start, count, pos int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeLine(sb *strings.Builder, prefix byte, line string) {
+	sb.WriteByte(prefix)
+	if strings.HasSuffix(line, "\n") {
+		sb.WriteString(line)
+		return
+	}
+	sb.WriteString(line)
+	sb.WriteString("\n\\ No newline at end of file\n")
+}
+
+// splitLines splits text after each newline, keeping the terminators.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edits computes a shortest edit script from a to b with the linear
+// space refinement of Myers' algorithm: find the middle snake of an
+// optimal path, then solve the halves on either side of it.
+func edits(a, b []string) []op {
+	var ops []op
+	var compare func(aLo, aHi, bLo, bHi int)
+	compare = func(aLo, aHi, bLo, bHi int) {
+		// Common lines at either end are always part of the script
+		for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+			ops = append(ops, op{kind: opEqual, a: aLo, b: bLo})
+			aLo++
+			bLo++
+		}
+		suffix := 0
+		for aLo < aHi-suffix && bLo < bHi-suffix && a[aHi-suffix-1] == b[bHi-suffix-1] {
+			suffix++
+		}
+		aHi, bHi = aHi-suffix, bHi-suffix
+
+		switch {
+		case aLo == aHi:
+			for y := bLo; y < bHi; y++ {
+				ops = append(ops, op{kind: opInsert, a: aLo, b: y})
+			}
+		case bLo == bHi:
+			for x := aLo; x < aHi; x++ {
+				ops = append(ops, op{kind: opDelete, a: x, b: bLo})
+			}
+		default:
+			x, y, u, v := middleSnake(a[aLo:aHi], b[bLo:bHi])
+			compare(aLo, aLo+x, bLo, bLo+y)
+			for i := 0; i < u-x; i++ {
+				ops = append(ops, op{kind: opEqual, a: aLo + x + i, b: bLo + y + i})
+			}
+			compare(aLo+u, aHi, bLo+v, bHi)
+		}
+
+		for i := 0; i < suffix; i++ {
+			ops = append(ops, op{kind: opEqual, a: aHi + i, b: bHi + i})
+		}
+	}
+	compare(0, len(a), 0, len(b))
+	return ops
+}
+
+// middleSnake searches from both ends of a and b at once until the paths
+// meet, and returns the snake where they do, from (x, y) to (u, v). Both
+// a and b must be non-empty and differ in their first and last lines, so
+// that at least one edit lies on either side of the snake.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+
+	// fwd[k] is the furthest x reached on diagonal k = x - y from the
+	// start; bwd[k] the same from the end, in reversed coordinates
+	fwd := make([]int, 2*maxD+3)
+	bwd := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && fwd[offset+k-1] < fwd[offset+k+1]) {
+				x = fwd[offset+k+1]
+			} else {
+				x = fwd[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			fwd[offset+k] = u
+			if rk := delta - k; delta%2 != 0 && rk >= -(d-1) && rk <= d-1 && u >= n-bwd[offset+rk] {
+				return x, y, u, v
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var rx int
+			if k == -d || (k != d && bwd[offset+k-1] < bwd[offset+k+1]) {
+				rx = bwd[offset+k+1]
+			} else {
+				rx = bwd[offset+k-1] + 1
+			}
+			ry := rx - k
+			endX, endY := rx, ry
+			for rx < n && ry < m && a[n-rx-1] == b[m-ry-1] {
+				rx++
+				ry++
+			}
+			bwd[offset+k] = rx
+			if fk := delta - k; delta%2 == 0 && fk >= -d && fk <= d && fwd[offset+fk] >= n-rx {
+				return n - rx, m - ry, n - endX, m - endY
+			}
+		}
+	}
+	panic("diff: middle snake not found")
+}
@@ -0,0 +1,181 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "create",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "remove all",
+			old:  "a\n",
+			new:  "",
+			want: "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "change one line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "insert after context",
+			old:  "1\n2\n3\n4\n5\n",
+			new:  "1\n2\n3\n4\n5\n6\n",
+			want: "--- old\n+++ new\n@@ -3,3 +3,4 @@\n 3\n 4\n 5\n+6\n",
+		},
+		{
+			name: "delete from the middle",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "1\n2\n3\n4\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,6 @@\n 2\n 3\n 4\n-5\n 6\n 7\n 8\n",
+		},
+		{
+			name: "two hunks",
+			old:  "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			new:  "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			name: "close changes share a hunk",
+			old:  "a\n1\n2\n3\n4\n5\n6\nb\n",
+			new:  "A\n1\n2\n3\n4\n5\n6\nB\n",
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-a\n+A\n 1\n 2\n 3\n 4\n 5\n 6\n-b\n+B\n",
+		},
+		{
+			name: "no newline at end of old",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "no newline at end of either",
+			old:  "a\nb",
+			new:  "a\nc",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.old, tt.new); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count, pos int
+		want              string
+	}{
+		{start: -1, count: 0, pos: 0, want: "0,0"},
+		{start: -1, count: 0, pos: 4, want: "4,0"},
+		{start: 0, count: 1, pos: 0, want: "1"},
+		{start: 6, count: 1, pos: 6, want: "7"},
+		{start: 2, count: 5, pos: 2, want: "3,5"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count, tt.pos); got != tt.want {
+			t.Errorf("hunkRange(%d, %d, %d) = %q, want %q", tt.start, tt.count, tt.pos, got, tt.want)
+		}
+	}
+}
+
+// TestEditsShortest checks random inputs against the length of their
+// longest common subsequence: a shortest script keeps exactly that many
+// lines and turns a into b.
+func TestEditsShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		a := randomLines(rng, rng.Intn(12))
+		b := randomLines(rng, rng.Intn(12))
+		ops := edits(a, b)
+
+		var got []string
+		equal, x, y := 0, 0, 0
+		for _, o := range ops {
+			switch o.kind {
+			case opEqual:
+				if o.a != x || o.b != y || a[o.a] != b[o.b] {
+					t.Fatalf("edits(%q, %q): bad equal op %+v", a, b, o)
+				}
+				got = append(got, b[o.b])
+				equal++
+				x++
+				y++
+			case opDelete:
+				if o.a != x {
+					t.Fatalf("edits(%q, %q): bad delete op %+v", a, b, o)
+				}
+				x++
+			case opInsert:
+				if o.b != y {
+					t.Fatalf("edits(%q, %q): bad insert op %+v", a, b, o)
+				}
+				got = append(got, b[o.b])
+				y++
+			}
+		}
+		if x != len(a) || strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("edits(%q, %q) does not turn a into b", a, b)
+		}
+		if want := lcs(a, b); equal != want {
+			t.Fatalf("edits(%q, %q) keeps %d lines, want %d", a, b, equal, want)
+		}
+	}
+}
+
+func TestEditsLargeRewrite(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 3000; i++ {
+		a = append(a, "old\n")
+		b = append(b, "new\n")
+	}
+	if ops := edits(a, b); len(ops) != len(a)+len(b) {
+		t.Fatalf("edits() = %d ops, want %d", len(ops), len(a)+len(b))
+	}
+}
+
+func randomLines(rng *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a'+rng.Intn(3))) + "\n"
+	}
+	return lines
+}
+
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
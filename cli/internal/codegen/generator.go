@@ -1,60 +1,176 @@
 package codegen
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"path"
+	"sync"
 
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
 	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/languages"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
 )
 
 type Generator struct {
-	config *types.Config
+	config  *types.Config
+	options Options
 }
 
-func NewGenerator(config *types.Config) *Generator {
-	return &Generator{config: config}
+// Options controls how the generator renders output.
+type Options struct {
+	// TemplateDir overrides built-in templates one file at a time.
+	// See languages/templates/README.md for the layout and data model.
+	TemplateDir string
+
+	// Output receives the generated files. Defaults to the current directory.
+	Output output.Sink
+
+	// Preserve is the directory holding previously generated files whose
+	// hand-written protected regions are carried over. Defaults to the
+	// current directory when Output is defaulted too; empty disables it.
+	Preserve string
+
+	// Force discards the hand-written code of protected regions that are
+	// no longer generated instead of failing.
+	Force bool
+
+	// Workers limits how many files are rendered concurrently across all
+	// languages. Zero or less means one per CPU.
+	Workers int
+}
+
+func NewGenerator(config *types.Config, options Options) *Generator {
+	if options.Output == nil {
+		options.Output = output.NewDirSink(".")
+		if options.Preserve == "" {
+			options.Preserve = "."
+		}
+	}
+	return &Generator{config: config, options: options}
 }
 
+// Generate renders every target language from one model. With
+// languages set, each one is written to a subdirectory of the project
+// named after its backend.
 func (g *Generator) Generate() error {
-	if err := g.createDirectories(); err != nil {
+	var backends []*languages.Backend
+	for _, lang := range g.config.Targets() {
+		backend, ok := languages.Lookup(lang)
+		if !ok {
+			return fmt.Errorf("unsupported language: %s", lang)
+		}
+		backends = append(backends, backend)
+	}
+
+	model, err := ir.Build(g.config)
+	if err != nil {
 		return err
 	}
 
-	var generator interface{ Generate() error }
+	// Render everything in memory first: nothing is written unless every
+	// language succeeds, and files reach the output in sorted order
+	// whichever order the workers finish in
+	staged := output.NewMemorySink()
+	var out output.Sink = staged
+	if g.options.Preserve != "" {
+		previous, err := ReadManifest(g.options.Preserve, g.config)
+		if err != nil {
+			return err
+		}
+		out = &preservingSink{Sink: staged, root: g.options.Preserve, manifest: previous, force: g.options.Force}
+	}
+	stubs := &stubSink{Sink: out, stubs: map[string]map[string]string{}}
+	out = stubs
+	workers := languages.NewWorkers(g.options.Workers)
 
-	switch strings.ToLower(g.config.Language) {
-	case "c":
-		generator = languages.NewCGenerator(g.config)
-	case "c++", "cpp":
-		generator = languages.NewCPPGenerator(g.config)
-	case "python":
-		generator = languages.NewPythonGenerator(g.config)
-	case "go":
-		generator = languages.NewGoGenerator(g.config)
-	case "javascript", "js":
-		generator = languages.NewJavaScriptGenerator(g.config)
-	case "java":
-		generator = languages.NewJavaGenerator(g.config)
-	default:
-		return fmt.Errorf("unsupported language: %s", g.config.Language)
+	errs := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		layout := g.layout(backend)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := createDirectories(staged, layout); err != nil {
+				errs[i] = err
+				return
+			}
+			err := backend.New(model, languages.Options{
+				TemplateDir: g.options.TemplateDir,
+				Output:      out,
+				Layout:      layout,
+				Workers:     workers,
+			}).Generate()
+			if err != nil {
+				errs[i] = inLanguage(backend.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
 	}
 
-	return generator.Generate()
+	manifest, err := NewManifest(g.config, staged)
+	if err != nil {
+		return err
+	}
+	manifest.Regions = stubs.stubs
+	data, err := manifest.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := staged.WriteFile(ManifestPath(g.config), data); err != nil {
+		return err
+	}
+	return staged.CopyTo(g.options.Output)
 }
 
-func (g *Generator) createDirectories() error {
-	dirs := []string{
-		filepath.Join(g.config.ProjectName, "source", "src"),
-		filepath.Join(g.config.ProjectName, "source", "include"),
+// inLanguage prefixes err, or each error joined in it, with the name of
+// the language that failed.
+func inLanguage(name string, err error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return fmt.Errorf("%s: %w", name, err)
 	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, fmt.Errorf("%s: %w", name, e))
+	}
+	return errors.Join(errs...)
+}
 
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
+// layout resolves where backend writes: the config's layout entry for
+// it, falling back to the backend's defaults below the project directory.
+func (g *Generator) layout(backend *languages.Backend) languages.Layout {
+	var layout languages.Layout
+	for name, lc := range g.config.Layout {
+		if b, ok := languages.Lookup(name); ok && b == backend {
+			layout = languages.Layout{
+				Root:    lc.Root,
+				Source:  lc.Source,
+				Include: lc.Include,
+				Package: lc.Package,
+			}
+		}
+	}
+	if layout.Root == "" {
+		layout.Root = g.config.ProjectName
+		if len(g.config.Languages) > 0 {
+			layout.Root = path.Join(layout.Root, backend.Name)
 		}
 	}
+	return layout.Merge(backend.Layout)
+}
+
+// createDirectories creates the directories of layout, so they exist
+// even when no file is generated into them.
+func createDirectories(out output.Sink, layout languages.Layout) error {
+	if err := out.MkdirAll(layout.SourceDir()); err != nil {
+		return err
+	}
+	if dir := layout.IncludeDir(); dir != "" {
+		return out.MkdirAll(dir)
+	}
 	return nil
 }
@@ -0,0 +1,199 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// source is one YAML file of a config: the root file or one it includes.
+type source struct {
+	file      string // as shown in diagnostics
+	config    *types.Config
+	positions positions
+}
+
+// parse decodes data, the contents of file, into cfg. Keys the config
+// does not define are reported, each one at its position, and skipped.
+func (l *loader) parse(file string, data []byte, cfg *types.Config) (*source, error) {
+	doc, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	start := len(l.diags)
+	if len(doc.Docs) > 0 && doc.Docs[0].Body != nil {
+		body := doc.Docs[0].Body
+		for {
+			*cfg = types.Config{}
+			err := yaml.NodeToValue(body, cfg, yaml.DisallowUnknownField())
+			var unknown *yaml.UnknownFieldError
+			if !errors.As(err, &unknown) {
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				break
+			}
+			tok := unknown.GetToken()
+			diag := Diagnostic{File: file, Line: 1, Column: 1, Message: unknown.GetMessage()}
+			if tok != nil && tok.Position != nil {
+				diag.Line, diag.Column = tok.Position.Line, tok.Position.Column
+			}
+			l.diags = append(l.diags, diag)
+			if !removeKey(body, tok) {
+				break
+			}
+		}
+	}
+	unknown := l.diags[start:]
+	sort.Slice(unknown, func(i, j int) bool {
+		if unknown[i].Line != unknown[j].Line {
+			return unknown[i].Line < unknown[j].Line
+		}
+		return unknown[i].Column < unknown[j].Column
+	})
+	index, err := indexPositions(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &source{file: file, config: cfg, positions: index}, nil
+}
+
+// removeKey deletes the mapping entry whose key is tok from below node,
+// reporting whether it found one.
+func removeKey(node ast.Node, tok *token.Token) bool {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for i, value := range n.Values {
+			if value.Key.GetToken() == tok {
+				n.Values = append(n.Values[:i], n.Values[i+1:]...)
+				return true
+			}
+			if removeKey(value.Value, tok) {
+				return true
+			}
+		}
+	case *ast.MappingValueNode:
+		return removeKey(n.Value, tok)
+	case *ast.SequenceNode:
+		for _, value := range n.Values {
+			if removeKey(value, tok) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loader reads a config file and, depth first, every file it includes.
+// A file reached twice through different includes is loaded once; a file
+// that includes itself, directly or not, is a cycle.
+type loader struct {
+	sources []*source
+	loaded  map[string]bool
+	stack   []string // files being loaded, outermost first
+	diags   Diagnostics
+}
+
+// loadSources returns the sources of the config in filename in merge
+// order: included files before the file including them.
+func loadSources(filename string) ([]*source, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{loaded: map[string]bool{}}
+	root, err := l.parse(filename, data, &types.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := l.load(root); err != nil {
+		return nil, err
+	}
+	if len(l.diags) > 0 {
+		return nil, l.diags
+	}
+	return l.sources, nil
+}
+
+func (l *loader) load(src *source) error {
+	abs, err := filepath.Abs(src.file)
+	if err != nil {
+		return err
+	}
+	l.loaded[abs] = true
+	l.stack = append(l.stack, src.file)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	for i, include := range src.config.Include {
+		path := fmt.Sprintf("$.include[%d]", i)
+		if strings.TrimSpace(include) == "" {
+			l.errorf(src, path, "include path is required")
+			continue
+		}
+
+		file := include
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(src.file), file)
+		}
+		incAbs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if cycle := l.cycle(incAbs); cycle != nil {
+			l.errorf(src, path, "include cycle: %s", strings.Join(append(cycle, file), " -> "))
+			continue
+		}
+		if l.loaded[incAbs] {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			l.errorf(src, path, "included file %s does not exist", file)
+			continue
+		} else if err != nil {
+			return err
+		}
+		inc, err := l.parse(file, data, &types.Config{})
+		if err != nil {
+			return err
+		}
+		if err := l.load(inc); err != nil {
+			return err
+		}
+	}
+
+	l.sources = append(l.sources, src)
+	return nil
+}
+
+// cycle returns the include chain from abs back to itself, or nil when
+// abs is not currently being loaded.
+func (l *loader) cycle(abs string) []string {
+	for i, file := range l.stack {
+		if a, err := filepath.Abs(file); err == nil && a == abs {
+			return append([]string(nil), l.stack[i:]...)
+		}
+	}
+	return nil
+}
+
+func (l *loader) errorf(src *source, path, format string, args ...any) {
+	pos := src.positions.lookup(path)
+	l.diags = append(l.diags, Diagnostic{
+		File:    src.file,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
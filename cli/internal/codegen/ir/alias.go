@@ -0,0 +1,67 @@
+package ir
+
+import (
+	"fmt"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// Alias is another name for a type. References to it resolve to a copy
+// of Type with Alias set, so backends can spell either the alias or the
+// type it stands for.
+type Alias struct {
+	Name string
+	Doc  string
+	Type *TypeRef
+	File *File
+}
+
+// buildAliases resolves the aliases of the config into m.Aliases, each
+// after the aliases its type uses, so references to those can already
+// copy their type.
+func (m *Model) buildAliases(acs []types.AliasConfig) error {
+	configs := map[string]types.AliasConfig{}
+	for _, ac := range acs {
+		configs[ac.Name] = ac
+	}
+	state := map[string]int{} // 1 while visiting, 2 once resolved
+	var visit func(ac types.AliasConfig) error
+	visit = func(ac types.AliasConfig) error {
+		switch state[ac.Name] {
+		case 1:
+			return fmt.Errorf("alias %s: alias cycle", ac.Name)
+		case 2:
+			return nil
+		}
+		state[ac.Name] = 1
+		t, err := ParseType(ac.Type)
+		if err != nil {
+			return fmt.Errorf("alias %s: %w", ac.Name, err)
+		}
+		var uses []types.AliasConfig
+		t.Walk(func(r *TypeRef) {
+			if dep, ok := configs[r.Name]; ok && r.Kind == Named {
+				uses = append(uses, dep)
+			}
+		})
+		for _, dep := range uses {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		if t, err = m.resolve(ac.Type, nil); err != nil {
+			return fmt.Errorf("alias %s: %w", ac.Name, err)
+		}
+		a := &Alias{Name: ac.Name, Doc: ac.Description, Type: t}
+		m.Aliases = append(m.Aliases, a)
+		m.aliases[a.Name] = a
+		state[ac.Name] = 2
+		return nil
+	}
+	for _, ac := range acs {
+		if err := visit(ac); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// Build resolves a config into a Model.
+func Build(cfg *types.Config) (*Model, error) {
+	m := &Model{
+		Project: cfg.ProjectName,
+		types:   map[string]*Type{},
+		enums:   map[string]*Enum{},
+		errors:  map[string]*ErrorType{},
+		aliases: map[string]*Alias{},
+	}
+
+	for _, ec := range cfg.Enums {
+		e, err := buildEnum(ec)
+		if err != nil {
+			return nil, fmt.Errorf("enum %s: %w", ec.Name, err)
+		}
+		m.Enums = append(m.Enums, e)
+		m.enums[e.Name] = e
+	}
+	for _, ec := range cfg.Errors {
+		e := buildError(ec)
+		m.Errors = append(m.Errors, e)
+		m.errors[e.Name] = e
+	}
+
+	// Declare every type first so fields and signatures can refer to
+	// types declared after them. Interfaces are abstract types.
+	tcs := cfg.AllTypes()
+	for _, tc := range tcs {
+		t := &Type{Name: tc.Name, Doc: tc.Description, Abstract: tc.Abstract}
+		m.Types = append(m.Types, t)
+		m.types[t.Name] = t
+	}
+	if err := m.buildAliases(cfg.Aliases); err != nil {
+		return nil, err
+	}
+
+	// Type parameters come first, as the type arguments of supertypes
+	// can use them
+	for i, tc := range tcs {
+		params, err := m.typeParams(tc.TypeParams, nil)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", tc.Name, err)
+		}
+		m.Types[i].TypeParams = params
+	}
+	for i, tc := range tcs {
+		if err := m.supertypes(m.Types[i], tc); err != nil {
+			return nil, fmt.Errorf("type %s: %w", tc.Name, err)
+		}
+	}
+
+	for i, tc := range tcs {
+		t := m.Types[i]
+		for _, fc := range tc.Fields {
+			if fc.Static || fc.Const {
+				// Shared by every instance, so no type argument applies
+				field, err := m.field(fc, nil, Private)
+				if err != nil {
+					return nil, fmt.Errorf("type %s, field %s: %w", tc.Name, fc.Name, err)
+				}
+				t.Statics = append(t.Statics, field)
+				continue
+			}
+			field, err := m.field(fc, t.TypeParams, Private)
+			if err != nil {
+				return nil, fmt.Errorf("type %s, field %s: %w", tc.Name, fc.Name, err)
+			}
+			t.Fields = append(t.Fields, field)
+		}
+		for _, cc := range tc.ConstructorConfigs() {
+			ctor, err := m.constructor(cc, t)
+			if err != nil {
+				return nil, fmt.Errorf("type %s, constructor %s: %w", tc.Name, cc.ConstructorName(), err)
+			}
+			t.Constructors = append(t.Constructors, ctor)
+		}
+		for _, mc := range tc.Methods {
+			fn, err := m.function(mc, t)
+			if err != nil {
+				return nil, fmt.Errorf("type %s, method %s: %w", tc.Name, mc.Name, err)
+			}
+			if mc.Static {
+				t.StaticMethods = append(t.StaticMethods, fn)
+			} else {
+				t.Methods = append(t.Methods, fn)
+			}
+		}
+	}
+
+	if err := m.sortTypes(); err != nil {
+		return nil, err
+	}
+	for _, t := range m.Types {
+		for _, fn := range t.Methods {
+			for _, super := range t.Supertypes() {
+				if fn.Overrides = super.LookupMethod(fn.Name); fn.Overrides != nil {
+					break
+				}
+			}
+		}
+	}
+
+	for _, fc := range cfg.Files {
+		f := &File{Name: fc.Name, Doc: fc.Description}
+		for _, vc := range fc.Variables {
+			v, err := m.field(vc, nil, Public)
+			if err != nil {
+				return nil, fmt.Errorf("file %s, variable %s: %w", fc.Name, vc.Name, err)
+			}
+			f.Variables = append(f.Variables, v)
+		}
+		for _, c := range fc.Functions {
+			fn, err := m.function(c, nil)
+			if err != nil {
+				return nil, fmt.Errorf("file %s, function %s: %w", fc.Name, c.Name, err)
+			}
+			f.Functions = append(f.Functions, fn)
+		}
+		m.Files = append(m.Files, f)
+	}
+	if err := m.place(cfg.Files); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// place puts every type, enum and alias in the file listing it, or in
+// the first file when none does, and the errors in the first file, then
+// records which files each file depends on.
+func (m *Model) place(files []types.FileConfig) error {
+	if len(m.Files) == 0 {
+		return nil
+	}
+	placed := map[string]*File{}
+	for i, fc := range files {
+		f := m.Files[i]
+		for _, name := range fc.Types {
+			if other, ok := placed[name]; ok {
+				return fmt.Errorf("file %s: type %s is already placed in file %s", f.Name, name, other.Name)
+			}
+			t, isType := m.types[name]
+			e, isEnum := m.enums[name]
+			a, isAlias := m.aliases[name]
+			switch {
+			case isType:
+				t.File = f
+			case isEnum:
+				e.File = f
+			case isAlias:
+				a.File = f
+			default:
+				return fmt.Errorf("file %s: undefined type %q", f.Name, name)
+			}
+			placed[name] = f
+		}
+	}
+	for _, e := range m.Enums {
+		if e.File == nil {
+			e.File = m.Files[0]
+		}
+		e.File.Enums = append(e.File.Enums, e)
+	}
+	for _, t := range m.Types {
+		if t.File == nil {
+			t.File = m.Files[0]
+		}
+		t.File.Types = append(t.File.Types, t)
+	}
+	for _, a := range m.Aliases {
+		if a.File == nil {
+			a.File = m.Files[0]
+		}
+		a.File.Aliases = append(a.File.Aliases, a)
+	}
+	for _, e := range m.Errors {
+		e.File = m.Files[0]
+		e.File.Errors = append(e.File.Errors, e)
+	}
+	for _, f := range m.Files {
+		f.Deps = m.deps(f)
+	}
+	return nil
+}
+
+// deps lists the files other than f declaring types, enums, errors or
+// aliases that f's types, functions and aliases use. A reference through
+// an alias uses the alias only; its file uses what the alias stands for.
+func (m *Model) deps(f *File) []*Dependency {
+	used := map[string]bool{}
+	refs := f.TypeRefs()
+	for _, a := range f.Aliases {
+		refs = append(refs, a.Type)
+	}
+	fns := f.Functions
+	for _, t := range f.Types {
+		refs = append(refs, t.TypeRefs()...)
+		fns = append(fns[:len(fns):len(fns)], t.AllMethods()...)
+	}
+	for _, fn := range fns {
+		for _, e := range fn.Throws {
+			used[e.Name] = true
+		}
+	}
+	var use func(r *TypeRef)
+	use = func(r *TypeRef) {
+		switch {
+		case r == nil:
+			return
+		case r.Alias != nil:
+			used[r.Alias.Name] = true
+			if r.Enum != nil {
+				// Defaults name the enumerators of the enum itself
+				used[r.Name] = true
+			}
+			return
+		case r.Decl != nil || r.Enum != nil:
+			used[r.Name] = true
+		}
+		use(r.Key)
+		use(r.Elem)
+		for _, arg := range r.Args {
+			use(arg)
+		}
+	}
+	for _, r := range refs {
+		use(r)
+	}
+
+	var deps []*Dependency
+	for _, other := range m.Files {
+		if other == f {
+			continue
+		}
+		dep := &Dependency{File: other}
+		for _, e := range other.Enums {
+			if used[e.Name] {
+				dep.Names = append(dep.Names, e.Name)
+			}
+		}
+		for _, t := range other.Types {
+			if used[t.Name] {
+				dep.Names = append(dep.Names, t.Name)
+			}
+		}
+		for _, e := range other.Errors {
+			if used[e.Name] {
+				dep.Names = append(dep.Names, e.Name)
+			}
+		}
+		for _, a := range other.Aliases {
+			if used[a.Name] {
+				dep.Aliases = append(dep.Aliases, a.Name)
+			}
+		}
+		if len(dep.Names) > 0 || len(dep.Aliases) > 0 {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// field builds a field of a type, or a file variable, resolving its
+// type in scope. Constants need a default to take their value from.
+func (m *Model) field(fc types.FieldConfig, scope []*TypeParam, defaultAccess Access) (*Field, error) {
+	access, err := parseAccess(fc.Access, defaultAccess)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := m.resolve(fc.Type, scope)
+	if err != nil {
+		return nil, err
+	}
+	field := &Field{
+		Name:   fc.Name,
+		Doc:    fc.Description,
+		Type:   typ,
+		Access: access,
+		Const:  fc.Const,
+	}
+	if fc.Default != nil {
+		if field.Default, err = ParseLiteral(fc.Default, typ); err != nil {
+			return nil, err
+		}
+	} else if fc.Const {
+		return nil, fmt.Errorf("constant has no default")
+	}
+	return field, nil
+}
+
+func (m *Model) function(fc types.FunctionConfig, owner *Type) (*Function, error) {
+	access, err := parseAccess(fc.Access, Public)
+	if err != nil {
+		return nil, err
+	}
+	var scope []*TypeParam
+	if owner != nil && !fc.Static {
+		scope = owner.TypeParams
+	}
+	params, err := m.typeParams(fc.TypeParams, scope)
+	if err != nil {
+		return nil, err
+	}
+	scope = append(scope[:len(scope):len(scope)], params...)
+	returns, err := m.resolve(fc.ReturnType, scope)
+	if err != nil {
+		return nil, err
+	}
+	fn := &Function{
+		Name:       fc.Name,
+		Doc:        fc.Description,
+		Returns:    returns,
+		ReturnDoc:  fc.ReturnDescription,
+		Access:     access,
+		Owner:      owner,
+		Abstract:   fc.Abstract,
+		TypeParams: params,
+	}
+	for _, pc := range fc.Parameters {
+		typ, err := m.resolve(pc.Type, scope)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", pc.Name, err)
+		}
+		fn.Params = append(fn.Params, &Param{Name: pc.Name, Doc: pc.Description, Type: typ})
+	}
+	for _, name := range fc.Throws {
+		e, ok := m.errors[name]
+		if !ok {
+			return nil, fmt.Errorf("undefined error %q", name)
+		}
+		fn.Throws = append(fn.Throws, e)
+	}
+	return fn, nil
+}
+
+func (m *Model) constructor(cc types.ConstructorConfig, owner *Type) (*Constructor, error) {
+	access, err := parseAccess(cc.Access, Public)
+	if err != nil {
+		return nil, err
+	}
+	ctor := &Constructor{Name: cc.ConstructorName(), Doc: cc.Description, Access: access, Owner: owner}
+	for _, pc := range cc.Parameters {
+		typ, err := m.resolve(pc.Type, owner.TypeParams)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", pc.Name, err)
+		}
+		p := &Param{Name: pc.Name, Doc: pc.Description, Type: typ}
+		for _, f := range owner.Fields {
+			if f.Name == p.Name {
+				p.Field = f
+			}
+		}
+		ctor.Params = append(ctor.Params, p)
+	}
+	return ctor, nil
+}
+
+// supertypes links t to the types it extends and implements, marking
+// all of them virtual.
+func (m *Model) supertypes(t *Type, tc types.TypeConfig) error {
+	if tc.Extends != "" {
+		base, err := m.resolve(tc.Extends, t.TypeParams)
+		if err != nil {
+			return err
+		}
+		if base.Decl == nil {
+			return fmt.Errorf("undefined base type %q", tc.Extends)
+		}
+		t.Base, t.Extends = base.Decl, base
+	}
+	for _, entry := range tc.Implements {
+		iface, err := m.resolve(entry, t.TypeParams)
+		if err != nil {
+			return err
+		}
+		if iface.Decl == nil {
+			return fmt.Errorf("undefined interface %q", entry)
+		}
+		t.Interfaces = append(t.Interfaces, iface.Decl)
+		t.Implements = append(t.Implements, iface)
+	}
+	if t.Abstract || len(t.Supertypes()) > 0 {
+		t.Virtual = true
+	}
+	for _, super := range t.Supertypes() {
+		super.Virtual = true
+	}
+	return nil
+}
+
+// sortTypes orders m.Types so every type follows its supertypes and the
+// types the constraints of its type parameters name, which most
+// languages need to be declared first. Types already in a valid order
+// keep it.
+func (m *Model) sortTypes() error {
+	sorted := make([]*Type, 0, len(m.Types))
+	state := map[*Type]int{} // 1 while visiting, 2 once placed
+	var visit func(t *Type) error
+	visit = func(t *Type) error {
+		switch state[t] {
+		case 1:
+			return fmt.Errorf("type %s: inheritance cycle", t.Name)
+		case 2:
+			return nil
+		}
+		state[t] = 1
+		for _, super := range t.Supertypes() {
+			if err := visit(super); err != nil {
+				return err
+			}
+		}
+
+		// A constraint or type argument naming a type being visited, such
+		// as its own type, is not a cycle: only inheritance needs the
+		// other type complete
+		refs := append(constraints(t.TypeParams), t.Supers()...)
+		for _, fn := range t.AllMethods() {
+			refs = append(refs, constraints(fn.TypeParams)...)
+		}
+		var err error
+		for _, ref := range refs {
+			ref.Walk(func(r *TypeRef) {
+				if r.Decl != nil && state[r.Decl] == 0 && err == nil {
+					err = visit(r.Decl)
+				}
+			})
+		}
+		if err != nil {
+			return err
+		}
+		state[t] = 2
+		sorted = append(sorted, t)
+		return nil
+	}
+	for _, t := range m.Types {
+		if err := visit(t); err != nil {
+			return err
+		}
+	}
+	m.Types = sorted
+	return nil
+}
+
+// typeParams builds the type parameters of a type or function. Their
+// constraints can use the parameters in scope and each other.
+func (m *Model) typeParams(tpcs []types.TypeParamConfig, scope []*TypeParam) ([]*TypeParam, error) {
+	var params []*TypeParam
+	for _, tpc := range tpcs {
+		params = append(params, &TypeParam{Name: tpc.Name, Doc: tpc.Description})
+	}
+	scope = append(scope[:len(scope):len(scope)], params...)
+	for i, tpc := range tpcs {
+		if tpc.Constraint == "" {
+			continue
+		}
+		c, err := m.resolve(tpc.Constraint, scope)
+		if err != nil {
+			return nil, fmt.Errorf("type parameter %s: %w", tpc.Name, err)
+		}
+		params[i].Constraint = c
+	}
+	return params, nil
+}
+
+// resolve parses a type string and links named types to their
+// declaration, or to the type parameter in scope of that name. Names of
+// aliases are replaced by the type they stand for.
+func (m *Model) resolve(s string, scope []*TypeParam) (*TypeRef, error) {
+	t, err := ParseType(s)
+	if err != nil {
+		return nil, err
+	}
+	m.link(t, scope)
+	return t, nil
+}
+
+func (m *Model) link(t *TypeRef, scope []*TypeParam) {
+	if t == nil {
+		return
+	}
+	if t.Kind == Named {
+		for _, p := range scope {
+			if p.Name == t.Name {
+				t.Param = p
+				return
+			}
+		}
+		if a, ok := m.aliases[t.Name]; ok {
+			isConst := t.Const
+			*t = *a.Type
+			t.Alias = a
+			t.Const = t.Const || isConst
+			return
+		}
+		t.Decl = m.types[t.Name]
+		t.Enum = m.enums[t.Name]
+	}
+	m.link(t.Key, scope)
+	m.link(t.Elem, scope)
+	for _, arg := range t.Args {
+		m.link(arg, scope)
+	}
+}
+
+func parseAccess(s string, fallback Access) (Access, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return fallback, nil
+	case "public":
+		return Public, nil
+	case "protected":
+		return Protected, nil
+	case "private":
+		return Private, nil
+	default:
+		return fallback, fmt.Errorf("unknown access level %q", s)
+	}
+}
@@ -0,0 +1,99 @@
+package ir
+
+import (
+	"fmt"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// Enum is a user-defined enumeration. Its values are either all integers
+// or, when Strings is set, all strings.
+type Enum struct {
+	Name    string
+	Doc     string
+	Values  []*EnumValue
+	Strings bool
+	File    *File // file the enum is declared in, if any
+}
+
+// EnumValue is one enumerator. In an integer enum Int is its value,
+// counting up from the previous one unless Explicit; in a string enum
+// String is its value, the enumerator's name unless Explicit.
+type EnumValue struct {
+	Name     string
+	Doc      string
+	Int      int
+	String   string
+	Explicit bool
+}
+
+// Sequential reports whether the enum's values are the integers 0, 1,
+// 2, ... in order, so a backend can leave them implicit.
+func (e *Enum) Sequential() bool {
+	if e.Strings {
+		return false
+	}
+	for i, v := range e.Values {
+		if v.Int != i {
+			return false
+		}
+	}
+	return true
+}
+
+// First is the enumerator a zero-valued field of the enum holds.
+func (e *Enum) First() *EnumValue {
+	return e.Values[0]
+}
+
+func buildEnum(ec types.EnumConfig) (*Enum, error) {
+	e := &Enum{Name: ec.Name, Doc: ec.Description}
+	if len(ec.Values) == 0 {
+		return nil, fmt.Errorf("no values")
+	}
+	for _, vc := range ec.Values {
+		if _, ok := vc.Value.(string); ok {
+			e.Strings = true
+		}
+	}
+
+	next := 0
+	for _, vc := range ec.Values {
+		v := &EnumValue{Name: vc.Name, Doc: vc.Description, Int: next, String: vc.Name}
+		n, s, isString, err := ParseEnumValue(vc.Value)
+		if err != nil {
+			return nil, fmt.Errorf("value %s: %w", vc.Name, err)
+		}
+		switch {
+		case vc.Value == nil:
+		case isString:
+			v.String, v.Explicit = s, true
+		case e.Strings:
+			return nil, fmt.Errorf("value %s: mixes integer and string values", vc.Name)
+		default:
+			v.Int, v.Explicit = n, true
+		}
+		next = v.Int + 1
+		e.Values = append(e.Values, v)
+	}
+	return e, nil
+}
+
+// ParseEnumValue interprets an enumerator's value as decoded from YAML,
+// which is an integer, a string or nil when the config gives none.
+func ParseEnumValue(v any) (n int, s string, isString bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, "", false, nil
+	case string:
+		return 0, v, true, nil
+	case int:
+		return v, "", false, nil
+	case int64:
+		return int(v), "", false, nil
+	case uint64:
+		return int(v), "", false, nil
+	default:
+		return 0, "", false, fmt.Errorf("value %v is neither an integer nor a string", v)
+	}
+}
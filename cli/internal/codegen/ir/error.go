@@ -0,0 +1,23 @@
+package ir
+
+import "github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+
+// ErrorType is an entry of the error catalog: an error functions can
+// throw. It is placed in the first file, or in its own class in Java.
+type ErrorType struct {
+	Name    string
+	Doc     string
+	Message string // default message
+	File    *File
+}
+
+func buildError(ec types.ErrorConfig) *ErrorType {
+	e := &ErrorType{Name: ec.Name, Doc: ec.Description, Message: ec.Message}
+	if e.Message == "" {
+		e.Message = ec.Description
+	}
+	if e.Message == "" {
+		e.Message = ec.Name
+	}
+	return e
+}
@@ -0,0 +1,424 @@
+// Package ir holds the resolved, language-neutral model every backend
+// renders from. It is built once from a types.Config: type strings are
+// parsed, references to user-defined types are resolved and access levels
+// and defaults are normalized, so backends never interpret raw config
+// strings themselves.
+package ir
+
+// Model is the resolved form of a whole config.
+type Model struct {
+	Project string
+	Types   []*Type
+	Enums   []*Enum
+	Errors  []*ErrorType
+	Files   []*File
+
+	// Aliases are in dependency order: each follows the aliases its
+	// type uses.
+	Aliases []*Alias
+
+	types   map[string]*Type
+	enums   map[string]*Enum
+	errors  map[string]*ErrorType
+	aliases map[string]*Alias
+}
+
+// Type is a user-defined record type with fields and methods.
+type Type struct {
+	Name       string
+	Doc        string
+	Fields     []*Field
+	Methods    []*Function
+	Base       *Type   // type this one extends
+	Interfaces []*Type // interfaces this one implements
+	Abstract   bool
+	TypeParams []*TypeParam
+
+	// Extends and Implements spell Base and Interfaces with the type
+	// arguments a generic interface is given, as in Comparable<Num>.
+	Extends    *TypeRef
+	Implements []*TypeRef
+
+	// Statics are the static fields and constants of the type, shared
+	// by all its instances, and StaticMethods the methods called on the
+	// type itself. Neither takes part in inheritance.
+	Statics       []*Field
+	StaticMethods []*Function
+
+	// Constructors take parameters. Every type also has an implicit
+	// constructor without parameters giving each field its default.
+	Constructors []*Constructor
+
+	// Virtual is set on every type taking part in inheritance: types
+	// with a base or interfaces, abstract types and extended types.
+	// Their methods are dispatched dynamically.
+	Virtual bool
+
+	// File is the file the type is declared in, nil when the config has
+	// no files.
+	File *File
+}
+
+type Field struct {
+	Name    string
+	Doc     string
+	Type    *TypeRef
+	Access  Access
+	Default *Literal // nil for the zero value of Type
+
+	// Const is set on constants, which always have a Default. Fields of
+	// a type that are constants are among its Statics.
+	Const bool
+}
+
+// Function is a method when Owner is set, a free function otherwise.
+type Function struct {
+	Name      string
+	Doc       string
+	Params    []*Param
+	Returns   *TypeRef
+	ReturnDoc string
+	Access    Access
+	Owner     *Type
+	Abstract  bool
+
+	// TypeParams are the function's own; a method can also use those
+	// of its Owner.
+	TypeParams []*TypeParam
+
+	// Throws lists the errors the function can fail with.
+	Throws []*ErrorType
+
+	// Overrides is the method of a base type or interface this one
+	// overrides or implements.
+	Overrides *Function
+}
+
+// TypeParam is a type parameter of a generic type or function. Type
+// references to it have Param set.
+type TypeParam struct {
+	Name       string
+	Doc        string
+	Constraint *TypeRef // nil when any type argument is allowed
+}
+
+type Param struct {
+	Name string
+	Doc  string
+	Type *TypeRef
+
+	// Field is the field a constructor parameter of the same name
+	// initializes, if any.
+	Field *Field
+}
+
+// Constructor initializes a new value of Owner from Params. Name is the
+// factory name languages without overloading use.
+type Constructor struct {
+	Name   string
+	Doc    string
+	Params []*Param
+	Access Access
+	Owner  *Type
+}
+
+// File is a generated compilation unit: the types and enums placed in
+// it and the free functions it holds.
+type File struct {
+	Name      string
+	Doc       string
+	Types     []*Type
+	Enums     []*Enum
+	Errors    []*ErrorType
+	Aliases   []*Alias
+	Functions []*Function
+
+	// Variables are the file-level constants and global variables.
+	Variables []*Field
+
+	// Deps lists the other files whose types, enums or errors this one
+	// uses, in file order.
+	Deps []*Dependency
+}
+
+// Dependency is a file another one uses and the names it uses from it,
+// in declaration order: enums first, then types, then errors. Aliases
+// holds the aliases it uses apart, since some languages only know them
+// at compile time.
+type Dependency struct {
+	File    *File
+	Names   []string
+	Aliases []string
+}
+
+// AllNames returns Names followed by Aliases.
+func (d *Dependency) AllNames() []string {
+	return append(d.Names[:len(d.Names):len(d.Names)], d.Aliases...)
+}
+
+// LookupType returns the user-defined type called name.
+func (m *Model) LookupType(name string) (*Type, bool) {
+	t, ok := m.types[name]
+	return t, ok
+}
+
+// LookupError returns the error of the catalog called name.
+func (m *Model) LookupError(name string) (*ErrorType, bool) {
+	e, ok := m.errors[name]
+	return e, ok
+}
+
+// LookupEnum returns the user-defined enum called name.
+func (m *Model) LookupEnum(name string) (*Enum, bool) {
+	e, ok := m.enums[name]
+	return e, ok
+}
+
+// LookupAlias returns the alias called name.
+func (m *Model) LookupAlias(name string) (*Alias, bool) {
+	a, ok := m.aliases[name]
+	return a, ok
+}
+
+// IsInterface reports whether t is a pure interface: abstract, without
+// fields or static members, with only abstract methods and at most an
+// interface as base.
+func (t *Type) IsInterface() bool {
+	if !t.Abstract || len(t.Fields) > 0 || len(t.Statics) > 0 || len(t.StaticMethods) > 0 {
+		return false
+	}
+	for _, m := range t.Methods {
+		if !m.Abstract {
+			return false
+		}
+	}
+	return t.Base == nil || t.Base.IsInterface()
+}
+
+// Supertypes returns the base type, if any, followed by the interfaces.
+func (t *Type) Supertypes() []*Type {
+	var supers []*Type
+	if t.Base != nil {
+		supers = append(supers, t.Base)
+	}
+	return append(supers, t.Interfaces...)
+}
+
+// Supers returns Extends, if set, followed by Implements: the
+// supertypes with their type arguments.
+func (t *Type) Supers() []*TypeRef {
+	var supers []*TypeRef
+	if t.Extends != nil {
+		supers = append(supers, t.Extends)
+	}
+	return append(supers, t.Implements...)
+}
+
+// LookupMethod finds the method called name on t or, failing that, on
+// its supertypes, depth first.
+func (t *Type) LookupMethod(name string) *Function {
+	for _, m := range t.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	for _, super := range t.Supertypes() {
+		if m := super.LookupMethod(name); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// HasAbstract reports whether any type in the model is abstract.
+func (m *Model) HasAbstract() bool {
+	return hasAbstract(m.Types)
+}
+
+// HasAbstract reports whether any type placed in the file is abstract.
+func (f *File) HasAbstract() bool {
+	return hasAbstract(f.Types)
+}
+
+func hasAbstract(types []*Type) bool {
+	for _, t := range types {
+		if t.Abstract {
+			return true
+		}
+	}
+	return false
+}
+
+// HasStatics reports whether any type placed in the file has static
+// fields or constants, or the file has variables.
+func (f *File) HasStatics() bool {
+	for _, t := range f.Types {
+		if len(t.Statics) > 0 {
+			return true
+		}
+	}
+	return len(f.Variables) > 0
+}
+
+// HasReturn reports whether the function returns a value.
+func (f *Function) HasReturn() bool {
+	return !f.Returns.IsVoid()
+}
+
+// Documented reports whether the config describes f, its parameters,
+// type parameters or return value, or f throws errors, so backends can
+// leave undocumented functions bare.
+func (f *Function) Documented() bool {
+	return f.Doc != "" || f.ReturnDoc != "" || len(f.Throws) > 0 || documented(f.Params) || documentedTypeParams(f.TypeParams)
+}
+
+// Documented reports whether the config describes c or its parameters.
+func (c *Constructor) Documented() bool {
+	return c.Doc != "" || documented(c.Params)
+}
+
+func documented(params []*Param) bool {
+	for _, p := range params {
+		if p.Doc != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// DocumentedTypeParams reports whether the config describes any of the
+// type's type parameters.
+func (t *Type) DocumentedTypeParams() bool {
+	return documentedTypeParams(t.TypeParams)
+}
+
+func documentedTypeParams(params []*TypeParam) bool {
+	for _, p := range params {
+		if p.Doc != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Access is a normalized access level.
+type Access int
+
+const (
+	Public Access = iota
+	Protected
+	Private
+)
+
+func (a Access) String() string {
+	switch a {
+	case Protected:
+		return "protected"
+	case Private:
+		return "private"
+	default:
+		return "public"
+	}
+}
+
+func (a Access) IsPublic() bool    { return a == Public }
+func (a Access) IsProtected() bool { return a == Protected }
+func (a Access) IsPrivate() bool   { return a == Private }
+
+// TypeRefs returns the parameter and return types of the function and
+// the constraints of its type parameters.
+func (f *Function) TypeRefs() []*TypeRef {
+	refs := append(constraints(f.TypeParams), f.Returns)
+	for _, p := range f.Params {
+		refs = append(refs, p.Type)
+	}
+	return refs
+}
+
+// TypeRefs returns every type used by the type's type parameters,
+// supertypes, fields, constructors and methods, static ones included.
+func (t *Type) TypeRefs() []*TypeRef {
+	refs := append(constraints(t.TypeParams), t.Supers()...)
+	for _, f := range t.Fields {
+		refs = append(refs, f.Type)
+	}
+	for _, f := range t.Statics {
+		refs = append(refs, f.Type)
+	}
+	for _, c := range t.Constructors {
+		for _, p := range c.Params {
+			refs = append(refs, p.Type)
+		}
+	}
+	for _, m := range t.AllMethods() {
+		refs = append(refs, m.TypeRefs()...)
+	}
+	return refs
+}
+
+// AllMethods returns the methods of t followed by its static methods.
+func (t *Type) AllMethods() []*Function {
+	return append(t.Methods[:len(t.Methods):len(t.Methods)], t.StaticMethods...)
+}
+
+// TypeRefs returns every type used by the file's functions and
+// variables. Types placed in the file are covered by their own TypeRefs.
+func (f *File) TypeRefs() []*TypeRef {
+	var refs []*TypeRef
+	for _, fn := range f.Functions {
+		refs = append(refs, fn.TypeRefs()...)
+	}
+	for _, v := range f.Variables {
+		refs = append(refs, v.Type)
+	}
+	return refs
+}
+
+// Uses reports whether kind appears in any type the file uses: in its
+// types, aliases, functions and variables.
+func (f *File) Uses(kind Kind) bool {
+	refs := f.TypeRefs()
+	for _, t := range f.Types {
+		refs = append(refs, t.TypeRefs()...)
+	}
+	for _, a := range f.Aliases {
+		refs = append(refs, a.Type)
+	}
+	return Uses(refs, kind)
+}
+
+// TypeParams returns the type parameters declared in the file by its
+// types, their methods and its functions, in that order.
+func (f *File) TypeParams() []*TypeParam {
+	var params []*TypeParam
+	for _, t := range f.Types {
+		params = append(params, t.TypeParams...)
+		for _, m := range t.AllMethods() {
+			params = append(params, m.TypeParams...)
+		}
+	}
+	for _, fn := range f.Functions {
+		params = append(params, fn.TypeParams...)
+	}
+	return params
+}
+
+func constraints(params []*TypeParam) []*TypeRef {
+	var refs []*TypeRef
+	for _, p := range params {
+		if p.Constraint != nil {
+			refs = append(refs, p.Constraint)
+		}
+	}
+	return refs
+}
+
+// Uses reports whether kind appears anywhere in refs.
+func Uses(refs []*TypeRef, kind Kind) bool {
+	for _, r := range refs {
+		if r.Uses(kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package ir
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Literal is a constant from the config, such as a field default, already
+// checked against the type it initializes. Value is a bool, an int64 for
+// integer types, a float64 for floating point types, a rune for char and
+// a string for string; Enum is set instead for enum types.
+type Literal struct {
+	Value any
+	Enum  *EnumValue
+}
+
+// ParseLiteral interprets v, as decoded from YAML, as a value of type t.
+// Enum types need t.Enum resolved.
+func ParseLiteral(v any, t *TypeRef) (*Literal, error) {
+	if t.Enum != nil {
+		if name, ok := v.(string); ok {
+			for _, ev := range t.Enum.Values {
+				if ev.Name == name {
+					return &Literal{Enum: ev}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("default %s is not an enumerator of %s", show(v), t.Name)
+	}
+
+	switch t.Kind {
+	case Bool:
+		if b, ok := v.(bool); ok {
+			return &Literal{Value: b}, nil
+		}
+	case Int, Long, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64, Size:
+		if n, ok := integer(v); ok {
+			if lo, hi := t.IntRange(); n < lo || n > hi {
+				return nil, fmt.Errorf("default %d is out of range for %s", n, t)
+			}
+			return &Literal{Value: n}, nil
+		}
+	case Float, Double:
+		if n, ok := integer(v); ok {
+			return &Literal{Value: float64(n)}, nil
+		}
+		if f, ok := v.(float64); ok && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return &Literal{Value: f}, nil
+		}
+	case Char:
+		if s, ok := v.(string); ok && utf8.RuneCountInString(s) == 1 {
+			r, _ := utf8.DecodeRuneInString(s)
+			return &Literal{Value: r}, nil
+		}
+	case String:
+		if s, ok := v.(string); ok {
+			return &Literal{Value: s}, nil
+		}
+	default:
+		return nil, fmt.Errorf("fields of type %s cannot have a default", t)
+	}
+	return nil, fmt.Errorf("default %s is not a valid %s", show(v), t)
+}
+
+func show(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
+func integer(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
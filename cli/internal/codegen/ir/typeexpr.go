@@ -0,0 +1,254 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseType parses a type expression:
+//
+//	type   = ["const"] base { "*" | "&" | "[" [int] "]" }
+//	base   = name [ "<" type { "," type } ">" ] | func
+//	func   = "fn" "(" [ type { "," type } ] ")" [ "->" type ]
+//	name   = ident { ident }      e.g. "int", "unsigned long", "std::string"
+//
+// The generic names list<T>, map<K,V> and optional<T> are built in; any
+// other name with arguments is a Named type with Args. "T[]" is a list
+// and "T[N]" a fixed-size array; "T[3][2]" is 3 arrays of 2 Ts, as in C
+// and Java. "fn(int) -> bool" is a function type, returning void without
+// "->"; its result type takes in any suffix that follows. "char*" is read
+// as a string for compatibility with C-style configs. An empty string is
+// void.
+func ParseType(s string) (*TypeRef, error) {
+	p := &typeParser{src: s}
+	p.next()
+	if p.tok == "" {
+		return &TypeRef{Kind: Void}, nil
+	}
+	t, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %q", p.tok)
+	}
+	return t, nil
+}
+
+type typeParser struct {
+	src string
+	pos int    // offset just past tok
+	tok string // current token, "" at end of input
+	at  int    // offset of tok
+}
+
+func (p *typeParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("type %q, column %d: %s", p.src, p.at+1, fmt.Sprintf(format, args...))
+}
+
+// next advances to the next token: an identifier (which may contain
+// "::"), a number or a single punctuation character.
+func (p *typeParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	p.at = p.pos
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	if isIdent(rune(p.src[p.pos])) {
+		for p.pos < len(p.src) && (isIdent(rune(p.src[p.pos])) || strings.HasPrefix(p.src[p.pos:], "::")) {
+			if p.src[p.pos] == ':' {
+				p.pos++
+			}
+			p.pos++
+		}
+	} else {
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (p *typeParser) expect(tok string) error {
+	if p.tok != tok {
+		if p.tok == "" {
+			return p.errorf("expected %q at end of type", tok)
+		}
+		return p.errorf("expected %q, found %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *typeParser) parseType() (*TypeRef, error) {
+	isConst := false
+	if p.tok == "const" {
+		isConst = true
+		p.next()
+	}
+
+	t, err := p.parseBase()
+	if err != nil {
+		return nil, err
+	}
+	t.Const = isConst
+
+	for {
+		switch p.tok {
+		case "*":
+			p.next()
+			if t.Kind == Char {
+				t = &TypeRef{Kind: String, Const: t.Const}
+			} else {
+				t = &TypeRef{Kind: Pointer, Elem: t}
+			}
+		case "&":
+			p.next()
+			t = &TypeRef{Kind: Reference, Elem: t}
+		case "[":
+			dims, err := p.parseDims()
+			if err != nil {
+				return nil, err
+			}
+			// The first of several dimensions is the outermost, as in C
+			// and Java: T[3][2] holds 3 arrays of 2 Ts
+			for i := len(dims) - 1; i >= 0; i-- {
+				if dims[i] == 0 {
+					t = &TypeRef{Kind: List, Elem: t}
+				} else {
+					t = &TypeRef{Kind: Array, Elem: t, Len: dims[i]}
+				}
+			}
+		default:
+			return t, nil
+		}
+	}
+}
+
+// parseDims parses a run of "[N]" and "[]" suffixes, returning their
+// lengths with 0 for a list.
+func (p *typeParser) parseDims() ([]int, error) {
+	var dims []int
+	for p.tok == "[" {
+		p.next()
+		if p.tok == "]" {
+			p.next()
+			dims = append(dims, 0)
+			continue
+		}
+		n, err := strconv.Atoi(p.tok)
+		if err != nil || n <= 0 {
+			return nil, p.errorf("array length must be a positive integer, found %q", p.tok)
+		}
+		p.next()
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		dims = append(dims, n)
+	}
+	return dims, nil
+}
+
+func (p *typeParser) parseBase() (*TypeRef, error) {
+	if p.tok == "" || !isIdent(rune(p.tok[0])) {
+		if p.tok == "" {
+			return nil, p.errorf("missing type name")
+		}
+		return nil, p.errorf("expected a type name, found %q", p.tok)
+	}
+
+	// Multi-word names such as "unsigned long"
+	words := []string{p.tok}
+	for p.next(); p.tok != "" && isIdent(rune(p.tok[0])); p.next() {
+		words = append(words, p.tok)
+	}
+	name := strings.Join(words, " ")
+
+	if name == "fn" && p.tok == "(" {
+		return p.parseFunc()
+	}
+	if p.tok != "<" {
+		if kind, ok := primitives[name]; ok {
+			return &TypeRef{Kind: kind}, nil
+		}
+		if _, ok := generics[name]; ok {
+			return nil, p.errorf("%s needs type arguments", name)
+		}
+		return &TypeRef{Kind: Named, Name: name}, nil
+	}
+
+	at := p.at
+	p.next()
+	var args []*TypeRef
+	for {
+		arg, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.tok != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(">"); err != nil {
+		return nil, err
+	}
+
+	g, ok := generics[name]
+	if !ok {
+		return &TypeRef{Kind: Named, Name: name, Args: args}, nil
+	}
+	if len(args) != g.arity {
+		p.at = at
+		return nil, p.errorf("%s takes %d type argument(s), found %d", name, g.arity, len(args))
+	}
+	if g.kind == Map {
+		return &TypeRef{Kind: Map, Key: args[0], Elem: args[1]}, nil
+	}
+	return &TypeRef{Kind: g.kind, Elem: args[0]}, nil
+}
+
+// parseFunc parses a function type from its opening parenthesis.
+func (p *typeParser) parseFunc() (*TypeRef, error) {
+	t := &TypeRef{Kind: Func}
+	p.next()
+	for p.tok != ")" {
+		if len(t.Args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if arg.IsVoid() {
+			return nil, p.errorf("function parameters cannot be void")
+		}
+		t.Args = append(t.Args, arg)
+	}
+	p.next()
+	if p.tok != "-" {
+		t.Elem = &TypeRef{Kind: Void}
+		return t, nil
+	}
+	p.next()
+	if err := p.expect(">"); err != nil {
+		return nil, err
+	}
+	elem, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	t.Elem = elem
+	return t, nil
+}
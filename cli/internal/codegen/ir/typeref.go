@@ -0,0 +1,301 @@
+package ir
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind classifies a TypeRef.
+type Kind int
+
+const (
+	Void Kind = iota
+	Bool
+	Char
+	Int
+	Long
+	// Sized and unsigned integers, and the unsigned size of memory.
+	Int8
+	Int16
+	Int32
+	Int64
+	Uint8
+	Uint16
+	Uint32
+	Uint64
+	Size
+	Float
+	Double
+	String
+	// Named refers to a user-defined type (Decl), enum (Enum) or type
+	// parameter (Param), or to an external type when all are nil. Args
+	// holds its type arguments, if any.
+	Named
+	// Pointer and Reference refer to Elem.
+	Pointer
+	Reference
+	// List and Optional wrap Elem.
+	List
+	Optional
+	// Map maps Key to Elem.
+	Map
+	// Array is a fixed-size array of Len Elems.
+	Array
+	// Func is a function taking Args and returning Elem, which is void
+	// when it returns nothing.
+	Func
+)
+
+// TypeRef is a parsed field, parameter or return type. See ParseType
+// for the syntax.
+type TypeRef struct {
+	Kind  Kind
+	Name  string     // spelling of a Named type
+	Args  []*TypeRef // type arguments of a Named type
+	Key   *TypeRef   // key of a Map
+	Elem  *TypeRef   // pointee, element or value type
+	Len   int        // length of an Array
+	Decl  *Type      // resolved declaration of a Named type
+	Enum  *Enum      // resolved declaration of a Named enum
+	Param *TypeParam // type parameter a Named type refers to
+	Const bool
+
+	// Alias is set when the type was spelled with an alias. The other
+	// fields then describe the type the alias stands for.
+	Alias *Alias
+}
+
+var primitives = map[string]Kind{
+	"void":        Void,
+	"bool":        Bool,
+	"boolean":     Bool,
+	"char":        Char,
+	"int":         Int,
+	"long":        Long,
+	"float":       Float,
+	"double":      Double,
+	"string":      String,
+	"std::string": String,
+
+	"int8":               Int8,
+	"int8_t":             Int8,
+	"int16":              Int16,
+	"int16_t":            Int16,
+	"short":              Int16,
+	"int32":              Int32,
+	"int32_t":            Int32,
+	"int64":              Int64,
+	"int64_t":            Int64,
+	"long long":          Int64,
+	"uint8":              Uint8,
+	"uint8_t":            Uint8,
+	"unsigned char":      Uint8,
+	"uint16":             Uint16,
+	"uint16_t":           Uint16,
+	"unsigned short":     Uint16,
+	"uint32":             Uint32,
+	"uint32_t":           Uint32,
+	"unsigned":           Uint32,
+	"unsigned int":       Uint32,
+	"uint64":             Uint64,
+	"uint64_t":           Uint64,
+	"unsigned long":      Uint64,
+	"unsigned long long": Uint64,
+	"size_t":             Size,
+	"std::size_t":        Size,
+}
+
+// generics maps the built-in generic names to their kind and arity.
+var generics = map[string]struct {
+	kind  Kind
+	arity int
+}{
+	"list":     {List, 1},
+	"optional": {Optional, 1},
+	"map":      {Map, 2},
+}
+
+func (t *TypeRef) IsVoid() bool      { return t == nil || t.Kind == Void }
+func (t *TypeRef) IsPointer() bool   { return t.Kind == Pointer }
+func (t *TypeRef) IsReference() bool { return t.Kind == Reference }
+func (t *TypeRef) IsList() bool      { return t.Kind == List }
+func (t *TypeRef) IsMap() bool       { return t.Kind == Map }
+func (t *TypeRef) IsOptional() bool  { return t.Kind == Optional }
+func (t *TypeRef) IsArray() bool     { return t.Kind == Array }
+func (t *TypeRef) IsNamed() bool     { return t.Kind == Named }
+func (t *TypeRef) IsEnum() bool      { return t.Enum != nil }
+func (t *TypeRef) IsTypeParam() bool { return t.Param != nil }
+func (t *TypeRef) IsFunc() bool      { return t.Kind == Func }
+func (t *TypeRef) IsAlias() bool     { return t.Alias != nil }
+
+// IsNumeric reports whether t is an integer or floating point type.
+func (t *TypeRef) IsNumeric() bool {
+	return t.IsInteger() || t.Kind == Float || t.Kind == Double
+}
+
+// IsInteger reports whether t is one of the integer types.
+func (t *TypeRef) IsInteger() bool {
+	return t.Kind == Int || t.Kind == Long || (t.Kind >= Int8 && t.Kind <= Size)
+}
+
+// IsUnsigned reports whether t is one of the unsigned integer types.
+func (t *TypeRef) IsUnsigned() bool {
+	return t.Kind >= Uint8 && t.Kind <= Size
+}
+
+// Bits returns the width of a sized integer type, or 0 for any other.
+func (t *TypeRef) Bits() int {
+	switch t.Kind {
+	case Int8, Uint8:
+		return 8
+	case Int16, Uint16:
+		return 16
+	case Int32, Uint32:
+		return 32
+	case Int64, Uint64:
+		return 64
+	}
+	return 0
+}
+
+// IntRange returns the smallest and largest values of an integer type.
+// Unsigned 64-bit types are capped at the largest int64, the widest
+// literal a config can hold.
+func (t *TypeRef) IntRange() (lo, hi int64) {
+	switch t.Kind {
+	case Int32:
+		return math.MinInt32, math.MaxInt32
+	case Int8:
+		return math.MinInt8, math.MaxInt8
+	case Int16:
+		return math.MinInt16, math.MaxInt16
+	case Uint8:
+		return 0, math.MaxUint8
+	case Uint16:
+		return 0, math.MaxUint16
+	case Uint32:
+		return 0, math.MaxUint32
+	case Uint64, Size:
+		return 0, math.MaxInt64
+	}
+	return math.MinInt64, math.MaxInt64
+}
+
+// Walk calls fn for t and every type nested inside it.
+func (t *TypeRef) Walk(fn func(*TypeRef)) {
+	if t == nil {
+		return
+	}
+	fn(t)
+	t.Key.Walk(fn)
+	t.Elem.Walk(fn)
+	for _, arg := range t.Args {
+		arg.Walk(fn)
+	}
+}
+
+// Uses reports whether kind appears anywhere in t.
+func (t *TypeRef) Uses(kind Kind) bool {
+	found := false
+	t.Walk(func(r *TypeRef) {
+		if r.Kind == kind {
+			found = true
+		}
+	})
+	return found
+}
+
+// Substitute returns t with the type parameters in bindings replaced by
+// the types bound to them, as in a method of a generic interface that a
+// type implements with type arguments.
+func (t *TypeRef) Substitute(bindings map[*TypeParam]*TypeRef) *TypeRef {
+	if t == nil || len(bindings) == 0 {
+		return t
+	}
+	if b, ok := bindings[t.Param]; ok && t.Param != nil {
+		return b
+	}
+	c := *t
+	c.Key = t.Key.Substitute(bindings)
+	c.Elem = t.Elem.Substitute(bindings)
+	c.Args = nil
+	for _, arg := range t.Args {
+		c.Args = append(c.Args, arg.Substitute(bindings))
+	}
+	return &c
+}
+
+// String renders t in the neutral config syntax.
+func (t *TypeRef) String() string {
+	if t.Alias != nil {
+		if t.Const {
+			return "const " + t.Alias.Name
+		}
+		return t.Alias.Name
+	}
+	var s string
+	switch t.Kind {
+	case Void:
+		s = "void"
+	case Bool:
+		s = "bool"
+	case Char:
+		s = "char"
+	case Int:
+		s = "int"
+	case Long:
+		s = "long"
+	case Int8, Int16, Int32, Int64:
+		s = "int" + strconv.Itoa(t.Bits())
+	case Uint8, Uint16, Uint32, Uint64:
+		s = "uint" + strconv.Itoa(t.Bits())
+	case Size:
+		s = "size_t"
+	case Float:
+		s = "float"
+	case Double:
+		s = "double"
+	case String:
+		s = "string"
+	case Named:
+		s = t.Name
+		if len(t.Args) > 0 {
+			args := make([]string, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = arg.String()
+			}
+			s += "<" + strings.Join(args, ", ") + ">"
+		}
+	case List:
+		s = "list<" + t.Elem.String() + ">"
+	case Optional:
+		s = "optional<" + t.Elem.String() + ">"
+	case Map:
+		s = "map<" + t.Key.String() + ", " + t.Elem.String() + ">"
+	case Pointer:
+		return t.Elem.String() + "*"
+	case Reference:
+		return t.Elem.String() + "&"
+	case Array:
+		// Nested lengths are spelled outermost first, as parsed
+		dims := ""
+		for ; t.Kind == Array && t.Alias == nil; t = t.Elem {
+			dims += "[" + strconv.Itoa(t.Len) + "]"
+		}
+		return t.String() + dims
+	case Func:
+		args := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = arg.String()
+		}
+		s = "fn(" + strings.Join(args, ", ") + ")"
+		if !t.Elem.IsVoid() {
+			s += " -> " + t.Elem.String()
+		}
+	}
+	if t.Const {
+		return "const " + s
+	}
+	return s
+}
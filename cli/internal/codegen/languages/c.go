@@ -2,113 +2,544 @@ package languages
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
+	"text/template"
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 )
 
 type CGenerator struct {
-	config *types.Config
+	model    *ir.Model
+	layout   Layout
+	output   output.Sink
+	workers  Workers
+	renderer *renderer
 }
 
-func NewCGenerator(config *types.Config) *CGenerator {
-	return &CGenerator{config: config}
+var cLayout = Layout{Source: "source/src", Include: "source/include"}
+
+func init() {
+	Register(Backend{
+		Name:   "c",
+		New:    func(model *ir.Model, opts Options) LanguageBackend { return NewCGenerator(model, opts) },
+		Layout: cLayout,
+	})
+}
+
+func NewCGenerator(model *ir.Model, opts Options) *CGenerator {
+	g := &CGenerator{model: model, layout: opts.layout(model, cLayout), output: opts.Output, workers: opts.Workers}
+	g.renderer = newRenderer("c", opts, template.FuncMap{
+		"typeName":     g.cType,
+		"defaultValue": g.cDefaultValue,
+		"decl":         g.cDecl,
+		"enumMember":   g.cEnumMember,
+		"initialValue": g.cInitialValue,
+		"funcDoc":      cDoxygen,
+		"returnType":   g.cReturnType,
+		"params":       g.cParams,
+		"status":       cStatus,
+		"constants":    g.constants,
+		"globals":      g.globals,
+		"macroValue":   g.macroValue,
+		"slots":        g.slots,
+		"vtable":       g.hasVTable,
+		"vtableBase":   g.vtableBase,
+		"vtableOf":     g.vtableOf,
+		"vtablePath":   g.vtablePath,
+		"vtableRef":    g.vtableRef,
+		"vtableInit":   g.vtableInit,
+		"interfaces":   g.interfaces,
+		"thunks":       g.thunks,
+		"args":         g.cArgs,
+	})
+	return g
 }
 
 func (g *CGenerator) Generate() error {
-	for _, file := range g.config.Files {
+	var tasks []func() error
+	for _, file := range g.model.Files {
+		data := TemplateData{Model: g.model, File: file}
+
 		// Generate header file
-		headerPath := filepath.Join(g.config.ProjectName, "source", "include", file.Name+".h")
-		headerContent := g.generateHeader(file)
-		if err := os.WriteFile(headerPath, []byte(headerContent), 0644); err != nil {
-			return err
-		}
+		headerPath := path.Join(g.layout.IncludeDir(), file.Name+".h")
+		tasks = append(tasks, writeTask(g.output, headerPath, func() (string, error) {
+			return g.renderer.render("header", data)
+		}))
 
 		// Generate source file
-		sourcePath := filepath.Join(g.config.ProjectName, "source", "src", file.Name+".c")
-		sourceContent := g.generateSource(file)
-		if err := os.WriteFile(sourcePath, []byte(sourceContent), 0644); err != nil {
-			return err
+		sourcePath := path.Join(g.layout.SourceDir(), file.Name+".c")
+		tasks = append(tasks, writeTask(g.output, sourcePath, func() (string, error) {
+			return g.renderer.render("source", data)
+		}))
+	}
+	return g.workers.run(tasks)
+}
+
+func (g *CGenerator) cType(t *ir.TypeRef) string {
+	if t.Alias != nil && t.Kind != ir.Array {
+		// Arrays decay to a pointer to their element outside of
+		// declarations, so their aliases only appear in cDecl
+		return g.constType(t, t.Alias.Name)
+	}
+	var name string
+	switch t.Kind {
+	case ir.Void:
+		return "void"
+	case ir.Bool:
+		name = "bool"
+	case ir.Char:
+		name = "char"
+	case ir.Int:
+		name = "int"
+	case ir.Long:
+		name = "long"
+	case ir.Int8, ir.Int16, ir.Int32, ir.Int64, ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64:
+		name = sizedInt(t) + "_t"
+	case ir.Size:
+		name = "size_t"
+	case ir.Float:
+		name = "float"
+	case ir.Double:
+		name = "double"
+	case ir.String:
+		name = "char*"
+	case ir.Named:
+		name = t.Name
+	case ir.Map:
+		// C has no map type; callers get an opaque handle
+		return "void*"
+	case ir.Func:
+		// The validator has function types named by an alias, so
+		// this abstract declarator only shows in the alias' typedef
+		return g.cDecl(t, "")
+	case ir.Reference, ir.Optional:
+		// Already nullable types are passed as they are
+		if g.isPointer(t.Elem) {
+			return g.constType(t, g.cType(t.Elem))
+		}
+		return g.constType(t, g.cType(t.Elem)) + "*"
+	default:
+		// Pointers, lists and arrays decay to a pointer to their element
+		return g.constType(t, g.cType(t.Elem)) + "*"
+	}
+	if t.Const {
+		return "const " + name
+	}
+	return name
+}
+
+// sizedInt spells a sized integer type the way <stdint.h> does without
+// its "_t" suffix, e.g. "int8" or "uint64": the Go spelling, and the
+// stem of the C and C++ ones.
+func sizedInt(t *ir.TypeRef) string {
+	if t.IsUnsigned() {
+		return "uint" + strconv.Itoa(t.Bits())
+	}
+	return "int" + strconv.Itoa(t.Bits())
+}
+
+// isPointer reports whether t is spelled as a pointer in C.
+func (g *CGenerator) isPointer(t *ir.TypeRef) bool {
+	switch t.Kind {
+	case ir.String, ir.Pointer, ir.List, ir.Array, ir.Map, ir.Optional:
+		return true
+	}
+	return false
+}
+
+// constType applies the const qualifier of a wrapper type t to the
+// spelling of its element.
+func (g *CGenerator) constType(t *ir.TypeRef, elem string) string {
+	if t.Const && !strings.HasPrefix(elem, "const ") {
+		return "const " + elem
+	}
+	return elem
+}
+
+// cDecl declares name with type t, placing array lengths and function
+// parameters after the name.
+func (g *CGenerator) cDecl(t *ir.TypeRef, name string) string {
+	switch {
+	case t.Alias != nil:
+		return g.constType(t, t.Alias.Name) + " " + name
+	case t.Kind == ir.Array:
+		return g.cDecl(t.Elem, fmt.Sprintf("%s[%d]", name, t.Len))
+	case t.Kind == ir.Func:
+		params := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			params[i] = g.cType(arg)
+		}
+		if len(params) == 0 {
+			params = []string{"void"}
+		}
+		return g.cDecl(t.Elem, fmt.Sprintf("(*%s)(%s)", name, strings.Join(params, ", ")))
+	}
+	return g.cType(t) + " " + name
+}
+
+// cReturnType is what fn returns in C: a Status when it throws, as the
+// result is then passed back through an out-parameter.
+func (g *CGenerator) cReturnType(fn *ir.Function) string {
+	if len(fn.Throws) > 0 {
+		return "Status"
+	}
+	return g.cType(fn.Returns)
+}
+
+// cParams declares the parameters of fn, followed by the result
+// out-parameter of functions that throw and return a value.
+func (g *CGenerator) cParams(fn *ir.Function) string {
+	decls := make([]string, 0, len(fn.Params)+1)
+	for _, p := range fn.Params {
+		decls = append(decls, g.cDecl(p.Type, p.Name))
+	}
+	if len(fn.Throws) > 0 && fn.HasReturn() {
+		decls = append(decls, g.cType(fn.Returns)+"* result")
+	}
+	return strings.Join(decls, ", ")
+}
+
+// cStatus is the Status enumerator reported for e, or STATUS_OK when e
+// is nil.
+func cStatus(e *ir.ErrorType) string {
+	if e == nil {
+		return "STATUS_OK"
+	}
+	return "STATUS_" + constant(e.Name)
+}
+
+// cGlobal is a constant or static variable of a file or type, which C
+// declares at file scope: constants as macros in upper snake case, and
+// the statics of a type prefixed with its name.
+type cGlobal struct {
+	*ir.Field
+	Name string
+}
+
+// constants lists the constants of the types in file, then those of the
+// file itself.
+func (g *CGenerator) constants(file *ir.File) []cGlobal {
+	var list []cGlobal
+	for _, t := range file.Types {
+		for _, f := range t.Statics {
+			if f.Const {
+				list = append(list, cGlobal{f, constant(t.Name) + "_" + constant(f.Name)})
+			}
+		}
+	}
+	for _, f := range file.Variables {
+		if f.Const {
+			list = append(list, cGlobal{f, constant(f.Name)})
+		}
+	}
+	return list
+}
+
+// globals lists the static fields of the types in file, then the
+// variables of the file, leaving out constants.
+func (g *CGenerator) globals(file *ir.File) []cGlobal {
+	var list []cGlobal
+	for _, t := range file.Types {
+		for _, f := range t.Statics {
+			if !f.Const {
+				list = append(list, cGlobal{f, t.Name + "_" + f.Name})
+			}
+		}
+	}
+	for _, f := range file.Variables {
+		if !f.Const {
+			list = append(list, cGlobal{f, f.Name})
+		}
+	}
+	return list
+}
+
+// macroValue is the replacement list of the macro for the constant f,
+// parenthesized when negative so it expands safely.
+func (g *CGenerator) macroValue(f *ir.Field) string {
+	v := g.cInitialValue(f)
+	if strings.HasPrefix(v, "-") {
+		return "(" + v + ")"
+	}
+	return v
+}
+
+// cEnumMember prefixes enumerators with their enum, since C puts them
+// all in one namespace.
+func (g *CGenerator) cEnumMember(e *ir.Enum, v *ir.EnumValue) string {
+	return constant(e.Name) + "_" + constant(v.Name)
+}
+
+// slots lists the methods t adds to the vtable of its base: those no
+// type in its base chain declares. Interfaces get vtables of their own,
+// so implementing one does not take a slot away.
+func (g *CGenerator) slots(t *ir.Type) []*ir.Function {
+	var slots []*ir.Function
+	for _, m := range t.Methods {
+		if !g.inherited(t, m.Name) {
+			slots = append(slots, m)
+		}
+	}
+	return slots
+}
+
+func (g *CGenerator) inherited(t *ir.Type, name string) bool {
+	for b := t.Base; b != nil; b = b.Base {
+		for _, m := range b.Methods {
+			if m.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasVTable reports whether t gets a vtable struct of its own.
+func (g *CGenerator) hasVTable(t *ir.Type) bool {
+	return t.Virtual && len(g.slots(t)) > 0
+}
+
+// vtableBase is the nearest base of t with a vtable, whose vtable the one
+// of t extends. It is nil when t starts a new vtable.
+func (g *CGenerator) vtableBase(t *ir.Type) *ir.Type {
+	for b := t.Base; b != nil; b = b.Base {
+		if g.hasVTable(b) {
+			return b
 		}
 	}
 	return nil
 }
 
-func (g *CGenerator) generateHeader(file types.FileConfig) string {
+// vtableOf is the type whose vtable struct the vtable instance of t
+// fills: t itself, or the nearest base with one when t adds no slots.
+// It is nil when no type in the base chain of t has a vtable.
+func (g *CGenerator) vtableOf(t *ir.Type) *ir.Type {
+	if g.hasVTable(t) {
+		return t
+	}
+	return g.vtableBase(t)
+}
+
+// vtablePath is the path from a value of t to the members its vtable
+// chain starts in, e.g. "base.base." in a type two levels below it.
+func (g *CGenerator) vtablePath(t *ir.Type) string {
+	path := ""
+	for c := t; c != nil; c = c.Base {
+		if g.hasVTable(c) && g.vtableBase(c) == nil {
+			return path
+		}
+		path += "base."
+	}
+	return path
+}
+
+// vtableRef points at the vtable instance of t as the vtable struct
+// its chain starts with, which the instance embeds first.
+func (g *CGenerator) vtableRef(t *ir.Type, instance string) string {
+	ref := "&" + instance
+	for vt := g.vtableOf(t); g.vtableBase(vt) != nil; vt = g.vtableBase(vt) {
+		ref += ".base"
+	}
+	return ref
+}
+
+// vtableInit is the initializer of a vtable instance of struct vt for
+// t, pointing every slot t implements at its thunk. Abstract slots are
+// left NULL.
+func (g *CGenerator) vtableInit(t, vt *ir.Type) string {
+	return g.vtableInitIndent(t, vt, "")
+}
+
+func (g *CGenerator) vtableInitIndent(t, vt *ir.Type, indent string) string {
 	var sb strings.Builder
+	sb.WriteString("{\n")
+	if base := g.vtableBase(vt); base != nil {
+		fmt.Fprintf(&sb, "%s    .base = %s,\n", indent, g.vtableInitIndent(t, base, indent+"    "))
+	}
+	for _, slot := range g.slots(vt) {
+		if g.impl(t, slot.Name) != nil {
+			fmt.Fprintf(&sb, "%s    .%s = %s_%s_slot,\n", indent, slot.Name, t.Name, slot.Name)
+		}
+	}
+	sb.WriteString(indent + "}")
+	return sb.String()
+}
 
-	guardName := strings.ToUpper(file.Name) + "_H"
-	sb.WriteString(fmt.Sprintf("#ifndef %s\n", guardName))
-	sb.WriteString(fmt.Sprintf("#define %s\n\n", guardName))
+// impl finds the method implementing name for t: the nearest one in its
+// base chain that is not abstract, or nil.
+func (g *CGenerator) impl(t *ir.Type, name string) *ir.Function {
+	for c := t; c != nil; c = c.Base {
+		for _, m := range c.Methods {
+			if m.Name == name && !m.Abstract {
+				return m
+			}
+		}
+	}
+	return nil
+}
 
-	// Generate struct definitions
-	for _, typ := range g.config.Types {
-		sb.WriteString(fmt.Sprintf("typedef struct %s {\n", typ.Name))
-		for _, field := range typ.Fields {
-			sb.WriteString(fmt.Sprintf("    %s %s;\n", field.Type, field.Name))
+// interfaces lists the interfaces with a vtable that t or any of its
+// bases implements, each of which t can be viewed as.
+func (g *CGenerator) interfaces(t *ir.Type) []*ir.Type {
+	var list []*ir.Type
+	seen := map[*ir.Type]bool{}
+	for c := t; c != nil; c = c.Base {
+		for _, i := range c.Interfaces {
+			if !seen[i] && g.vtableOf(i) != nil {
+				seen[i] = true
+				list = append(list, i)
+			}
 		}
-		sb.WriteString(fmt.Sprintf("} %s;\n\n", typ.Name))
 	}
+	return list
+}
 
-	// Generate function declarations
-	for _, fn := range file.Functions {
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = fmt.Sprintf("%s %s", param.Type, param.Name)
+// thunks lists the implementations behind the slots the vtables of t
+// fill, once per method name. Each gets a thunk taking self as the
+// void pointer every slot does.
+func (g *CGenerator) thunks(t *ir.Type) []*ir.Function {
+	var list []*ir.Function
+	seen := map[string]bool{}
+	add := func(vt *ir.Type) {
+		// Follow the vtable layout, which starts with the base's slots
+		var chain []*ir.Type
+		for ; vt != nil; vt = g.vtableBase(vt) {
+			chain = append([]*ir.Type{vt}, chain...)
 		}
-		returnType := fn.ReturnType
-		if returnType == "" {
-			returnType = "void"
+		for _, vt := range chain {
+			for _, slot := range g.slots(vt) {
+				if m := g.impl(t, slot.Name); m != nil && !seen[slot.Name] {
+					seen[slot.Name] = true
+					list = append(list, m)
+				}
+			}
 		}
-		sb.WriteString(fmt.Sprintf("%s %s(%s);\n",
-			returnType,
-			fn.Name,
-			strings.Join(params, ", ")))
 	}
+	add(g.vtableOf(t))
+	for _, i := range g.interfaces(t) {
+		add(g.vtableOf(i))
+	}
+	return list
+}
 
-	sb.WriteString(fmt.Sprintf("\n#endif // %s\n", guardName))
+// cArgs passes the parameters of fn on, after self, including the
+// result out-parameter of functions that throw and return a value.
+func (g *CGenerator) cArgs(fn *ir.Function) string {
+	var sb strings.Builder
+	for _, p := range fn.Params {
+		sb.WriteString(", " + p.Name)
+	}
+	if len(fn.Throws) > 0 && fn.HasReturn() {
+		sb.WriteString(", result")
+	}
 	return sb.String()
 }
 
-func (g *CGenerator) generateSource(file types.FileConfig) string {
-	var sb strings.Builder
+// doxygen is the Doxygen comment of a function, constructor or generic
+// type, shared by C and C++, each line starting with indent, or "" when
+// the config describes neither it nor its parameters.
+func doxygen(indent string, fn any) string {
+	return doxygenStatus(indent, fn, false)
+}
+
+// cDoxygen is doxygen for C, which documents the errors of a function
+// as the Status values it returns.
+func cDoxygen(indent string, fn any) string {
+	return doxygenStatus(indent, fn, true)
+}
+
+func doxygenStatus(indent string, fn any, status bool) string {
+	var doc, returns string
+	var typeParams []*ir.TypeParam
+	var params []*ir.Param
+	var throws []*ir.ErrorType
+	switch fn := fn.(type) {
+	case *ir.Type:
+		doc, typeParams = fn.Doc, fn.TypeParams
+	case *ir.Function:
+		doc, typeParams, params, returns, throws = fn.Doc, fn.TypeParams, fn.Params, fn.ReturnDoc, fn.Throws
+	case *ir.Constructor:
+		doc, params = fn.Doc, fn.Params
+	}
 
-	sb.WriteString(fmt.Sprintf("#include \"%s.h\"\n\n", file.Name))
-
-	// Generate function implementations
-	for _, fn := range file.Functions {
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = fmt.Sprintf("%s %s", param.Type, param.Name)
-		}
-		returnType := fn.ReturnType
-		if returnType == "" {
-			returnType = "void"
-		}
-
-		sb.WriteString(fmt.Sprintf("%s %s(%s) {\n",
-			returnType,
-			fn.Name,
-			strings.Join(params, ", ")))
-
-		// Add placeholder return statement if needed
-		if returnType != "void" {
-			switch {
-			case strings.Contains(returnType, "int"):
-				sb.WriteString("    return 0;\n")
-			case strings.Contains(returnType, "char"):
-				sb.WriteString("    return '\\0';\n")
-			case strings.Contains(returnType, "*"):
-				sb.WriteString("    return NULL;\n")
-			default:
-				sb.WriteString("    return 0;\n")
+	var lines []string
+	if doc != "" {
+		lines = append(lines, strings.TrimSpace(doc))
+	}
+	for _, p := range typeParams {
+		if p.Doc != "" {
+			lines = append(lines, "@tparam "+p.Name+" "+strings.TrimSpace(p.Doc))
+		}
+	}
+	for _, p := range params {
+		if p.Doc != "" {
+			lines = append(lines, "@param "+p.Name+" "+strings.TrimSpace(p.Doc))
+		}
+	}
+	switch {
+	case status && len(throws) > 0:
+		if returns != "" {
+			lines = append(lines, "@param[out] result "+strings.TrimSpace(returns))
+		}
+		lines = append(lines, "@retval "+cStatus(nil)+" on success")
+		for _, e := range throws {
+			doc := strings.TrimSpace(e.Doc)
+			if doc == "" {
+				doc = e.Message
 			}
+			lines = append(lines, "@retval "+cStatus(e)+" "+doc)
+		}
+	default:
+		if returns != "" {
+			lines = append(lines, "@return "+strings.TrimSpace(returns))
+		}
+		for _, e := range throws {
+			lines = append(lines, strings.TrimSpace("@throws "+e.Name+" "+strings.TrimSpace(e.Doc)))
 		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return indent + "/**\n" + comment(indent+" * ", strings.Join(lines, "\n")) + "\n" + indent + " */"
+}
 
-		sb.WriteString("}\n\n")
+// cInitialValue is what <Type>_init assigns to f.
+func (g *CGenerator) cInitialValue(f *ir.Field) string {
+	switch l := f.Default; {
+	case l == nil:
+		return g.cDefaultValue(f.Type)
+	case l.Enum != nil:
+		return g.cEnumMember(f.Type.Enum, l.Enum)
+	case f.Type.Kind == ir.Float:
+		return literal(l) + "f"
+	default:
+		return literal(l)
 	}
+}
 
-	return sb.String()
+// cDefaultValue is the placeholder a stub returns for t.
+func (g *CGenerator) cDefaultValue(t *ir.TypeRef) string {
+	switch t.Kind {
+	case ir.Bool:
+		return "false"
+	case ir.Char:
+		return "'\\0'"
+	case ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size:
+		return "0"
+	case ir.Float:
+		return "0.0f"
+	case ir.Double:
+		return "0.0"
+	case ir.Named:
+		if t.Enum != nil {
+			return g.cEnumMember(t.Enum, t.Enum.First())
+		}
+		return "(" + t.Name + "){0}"
+	default:
+		return "NULL"
+	}
 }
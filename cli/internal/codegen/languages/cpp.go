@@ -2,184 +2,333 @@ package languages
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
+	"text/template"
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 )
 
 type CPPGenerator struct {
-	config *types.Config
+	model    *ir.Model
+	layout   Layout
+	output   output.Sink
+	workers  Workers
+	renderer *renderer
 }
 
-func NewCPPGenerator(config *types.Config) *CPPGenerator {
-	return &CPPGenerator{config: config}
+var cppLayout = Layout{Source: "source/src", Include: "source/include"}
+
+func init() {
+	Register(Backend{
+		Name:    "cpp",
+		Aliases: []string{"c++"},
+		New:     func(model *ir.Model, opts Options) LanguageBackend { return NewCPPGenerator(model, opts) },
+		Layout:  cppLayout,
+	})
+}
+
+func NewCPPGenerator(model *ir.Model, opts Options) *CPPGenerator {
+	g := &CPPGenerator{model: model, layout: opts.layout(model, cppLayout), output: opts.Output, workers: opts.Workers}
+	g.renderer = newRenderer("cpp", opts, template.FuncMap{
+		"typeName":     g.cppType,
+		"defaultValue": g.cppDefaultValue,
+		"enumMember":   g.cppEnumMember,
+		"initialValue": g.cppInitialValue,
+		"funcDoc":      doxygen,
+		"templateHead": g.cppTemplateHead,
+		"forwardDecls": g.forwardDecls,
+		"storage":      g.cppStorage,
+		"forwards":     g.forwards,
+	})
+	return g
 }
 
 func (g *CPPGenerator) Generate() error {
-	for _, file := range g.config.Files {
+	var tasks []func() error
+	for _, file := range g.model.Files {
+		data := TemplateData{Model: g.model, File: file, Imports: g.includes(file)}
+
 		// Generate header file
-		headerPath := filepath.Join(g.config.ProjectName, "source", "include", file.Name+".hpp")
-		headerContent := g.generateHeader(file)
-		if err := os.WriteFile(headerPath, []byte(headerContent), 0644); err != nil {
-			return err
-		}
+		headerPath := path.Join(g.layout.IncludeDir(), file.Name+".hpp")
+		tasks = append(tasks, writeTask(g.output, headerPath, func() (string, error) {
+			return g.renderer.render("header", data)
+		}))
 
 		// Generate source file
-		sourcePath := filepath.Join(g.config.ProjectName, "source", "src", file.Name+".cpp")
-		sourceContent := g.generateSource(file)
-		if err := os.WriteFile(sourcePath, []byte(sourceContent), 0644); err != nil {
-			return err
+		sourcePath := path.Join(g.layout.SourceDir(), file.Name+".cpp")
+		tasks = append(tasks, writeTask(g.output, sourcePath, func() (string, error) {
+			return g.renderer.render("source", data)
+		}))
+	}
+	return g.workers.run(tasks)
+}
+
+func (g *CPPGenerator) cppType(t *ir.TypeRef) string {
+	if t.Alias != nil {
+		if t.Const {
+			return "const " + t.Alias.Name
 		}
+		return t.Alias.Name
 	}
-	return nil
+	var name string
+	switch t.Kind {
+	case ir.Void:
+		return "void"
+	case ir.Bool:
+		name = "bool"
+	case ir.Char:
+		name = "char"
+	case ir.Int:
+		name = "int"
+	case ir.Long:
+		name = "long"
+	case ir.Int8, ir.Int16, ir.Int32, ir.Int64, ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64:
+		name = "std::" + sizedInt(t) + "_t"
+	case ir.Size:
+		name = "std::size_t"
+	case ir.Float:
+		name = "float"
+	case ir.Double:
+		name = "double"
+	case ir.String:
+		name = "std::string"
+	case ir.Named:
+		name = t.Name
+		if len(t.Args) > 0 {
+			name += "<" + g.cppTypes(t.Args) + ">"
+		}
+	case ir.List:
+		name = "std::vector<" + g.cppTypes([]*ir.TypeRef{t.Elem}) + ">"
+	case ir.Optional:
+		name = "std::optional<" + g.cppTypes([]*ir.TypeRef{t.Elem}) + ">"
+	case ir.Map:
+		name = "std::map<" + g.cppTypes([]*ir.TypeRef{t.Key, t.Elem}) + ">"
+	case ir.Array:
+		name = fmt.Sprintf("std::array<%s, %d>", g.cppTypes([]*ir.TypeRef{t.Elem}), t.Len)
+	case ir.Pointer:
+		return g.cppType(t.Elem) + "*"
+	case ir.Reference:
+		return g.cppType(t.Elem) + "&"
+	case ir.Func:
+		name = "std::function<" + g.cppType(t.Elem) + "(" + g.cppTypes(t.Args) + ")>"
+	}
+	if t.Const {
+		return "const " + name
+	}
+	return name
 }
 
-func (g *CPPGenerator) generateHeader(file types.FileConfig) string {
-	var sb strings.Builder
+// cppTypes spells template arguments. Standard containers cannot hold
+// const values, so a top-level const is dropped.
+func (g *CPPGenerator) cppTypes(refs []*ir.TypeRef) string {
+	names := make([]string, len(refs))
+	for i, r := range refs {
+		names[i] = strings.TrimPrefix(g.cppType(r), "const ")
+	}
+	return strings.Join(names, ", ")
+}
 
-	guardName := strings.ToUpper(file.Name) + "_HPP"
-	sb.WriteString(fmt.Sprintf("#ifndef %s\n", guardName))
-	sb.WriteString(fmt.Sprintf("#define %s\n\n", guardName))
-	sb.WriteString("#include <string>\n\n")
+// cppDefaultValue is the placeholder a stub returns for t. References
+// have none; the template returns a function-local static instead.
+func (g *CPPGenerator) cppEnumMember(e *ir.Enum, v *ir.EnumValue) string {
+	return v.Name
+}
 
-	// Generate class definitions
-	for _, typ := range g.config.Types {
-		sb.WriteString(fmt.Sprintf("class %s {\n", typ.Name))
+// cppInitialValue is the default member initializer of f, for fields
+// with a default.
+func (g *CPPGenerator) cppInitialValue(f *ir.Field) string {
+	switch l := f.Default; {
+	case l == nil:
+		return g.cppDefaultValue(f.Type)
+	case l.Enum != nil:
+		return f.Type.Name + "::" + g.cppEnumMember(f.Type.Enum, l.Enum)
+	case f.Type.Kind == ir.Float:
+		return literal(l) + "f"
+	default:
+		return literal(l)
+	}
+}
 
-		// Private members by default
-		sb.WriteString("private:\n")
-		for _, field := range typ.Fields {
-			if field.Access != "public" && field.Access != "protected" {
-				sb.WriteString(fmt.Sprintf("    %s %s;\n", field.Type, field.Name))
-			}
+func (g *CPPGenerator) cppDefaultValue(t *ir.TypeRef) string {
+	switch t.Kind {
+	case ir.Bool:
+		return "false"
+	case ir.Char:
+		return "'\\0'"
+	case ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size:
+		return "0"
+	case ir.Float:
+		return "0.0f"
+	case ir.Double:
+		return "0.0"
+	case ir.String:
+		return "\"\""
+	case ir.Pointer:
+		return "nullptr"
+	case ir.Named:
+		if t.Enum != nil {
+			return t.Name + "::" + g.cppEnumMember(t.Enum, t.Enum.First())
 		}
+		return "{}"
+	default:
+		return "{}"
+	}
+}
 
-		// Protected members
-		hasProtected := false
-		for _, field := range typ.Fields {
-			if field.Access == "protected" {
-				if !hasProtected {
-					sb.WriteString("\nprotected:\n")
-					hasProtected = true
-				}
-				sb.WriteString(fmt.Sprintf("    %s %s;\n", field.Type, field.Name))
-			}
-		}
+// cppStorage is the specifiers a static field or file variable f is
+// declared with, so the header can define it. Constants are constexpr,
+// except strings, as std::string cannot be built at compile time.
+func (g *CPPGenerator) cppStorage(f *ir.Field) string {
+	switch {
+	case f.Const && f.Type.Kind == ir.String:
+		return "inline const "
+	case f.Const:
+		return "constexpr "
+	default:
+		return "inline "
+	}
+}
 
-		// Public members
-		sb.WriteString("\npublic:\n")
-		// Constructor
-		sb.WriteString(fmt.Sprintf("    %s() = default;\n", typ.Name))
+// cppTemplateHead is the template declaration for params, with a
+// requires clause for their constraints, or "" when there are none.
+func (g *CPPGenerator) cppTemplateHead(params []*ir.TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := make([]string, len(params))
+	var requires []string
+	for i, p := range params {
+		names[i] = "typename " + p.Name
+		if p.Constraint != nil {
+			requires = append(requires, "std::derived_from<"+p.Name+", "+g.cppType(p.Constraint)+">")
+		}
+	}
+	head := "template <" + strings.Join(names, ", ") + ">"
+	if len(requires) > 0 {
+		head += " requires " + strings.Join(requires, " && ")
+	}
+	return head
+}
 
-		// Public fields
-		for _, field := range typ.Fields {
-			if field.Access == "public" {
-				sb.WriteString(fmt.Sprintf("    %s %s;\n", field.Type, field.Name))
-			}
+// includes lists the standard headers needed by the types in file.
+func (g *CPPGenerator) includes(file *ir.File) []string {
+	headers := []string{"string"}
+	for _, h := range []struct {
+		kind   ir.Kind
+		header string
+	}{
+		{ir.Array, "array"},
+		{ir.Size, "cstddef"},
+		{ir.Func, "functional"},
+		{ir.Map, "map"},
+		{ir.Optional, "optional"},
+		{ir.List, "vector"},
+	} {
+		if file.Uses(h.kind) {
+			headers = append(headers, h.header)
 		}
+	}
+	for _, kind := range []ir.Kind{ir.Int8, ir.Int16, ir.Int32, ir.Int64, ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64} {
+		if file.Uses(kind) {
+			headers = append(headers, "cstdint")
+			break
+		}
+	}
+	if len(file.Errors) > 0 {
+		headers = append(headers, "stdexcept")
+	}
+	for _, p := range file.TypeParams() {
+		if p.Constraint != nil {
+			headers = append([]string{"concepts"}, headers...)
+			break
+		}
+	}
+	return headers
+}
 
-		// Method declarations
-		for _, method := range typ.Methods {
-			params := make([]string, len(method.Parameters))
-			for i, param := range method.Parameters {
-				params[i] = fmt.Sprintf("%s %s", param.Type, param.Name)
-			}
-			returnType := method.ReturnType
-			if returnType == "" {
-				returnType = "void"
+// forwardDecls lists the types of file its aliases use, which need to
+// be declared before the aliases while their classes follow them.
+func (g *CPPGenerator) forwardDecls(file *ir.File) []*ir.Type {
+	used := map[*ir.Type]bool{}
+	for _, a := range file.Aliases {
+		a.Type.Walk(func(r *ir.TypeRef) {
+			if r.Decl != nil && r.Decl.File == file {
+				used[r.Decl] = true
 			}
-			sb.WriteString(fmt.Sprintf("    %s %s(%s);\n",
-				returnType,
-				method.Name,
-				strings.Join(params, ", ")))
+		})
+	}
+	var decls []*ir.Type
+	for _, t := range file.Types {
+		if used[t] {
+			decls = append(decls, t)
 		}
-
-		sb.WriteString("};\n\n")
 	}
-
-	sb.WriteString(fmt.Sprintf("\n#endif // %s\n", guardName))
-	return sb.String()
+	return decls
 }
 
-func (g *CPPGenerator) generateSource(file types.FileConfig) string {
-	var sb strings.Builder
-
-	sb.WriteString(fmt.Sprintf("#include \"%s.hpp\"\n\n", file.Name))
+// cppForward is an interface method that a type implements only through
+// its base class. C++ does not let the base's method fill the slot of an
+// interface the type adds, so the type overrides it to forward the call.
+type cppForward struct {
+	Slot *ir.Function // the interface method
+	Base *ir.Type     // the base class defining it
+}
 
-	// Generate method implementations for each class
-	for _, typ := range g.config.Types {
-		for _, method := range typ.Methods {
-			params := make([]string, len(method.Parameters))
-			for i, param := range method.Parameters {
-				params[i] = fmt.Sprintf("%s %s", param.Type, param.Name)
+// forwards lists the methods of the interfaces t implements, and of
+// theirs, that t leaves to a base class. The methods of a generic
+// interface are spelled with the type arguments t gives it.
+func (g *CPPGenerator) forwards(t *ir.Type) []cppForward {
+	if t.Base == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, m := range t.Methods {
+		seen[m.Name] = true
+	}
+	var list []cppForward
+	var visit func(i *ir.TypeRef)
+	visit = func(i *ir.TypeRef) {
+		bindings := map[*ir.TypeParam]*ir.TypeRef{}
+		for n, p := range i.Decl.TypeParams {
+			if n < len(i.Args) {
+				bindings[p] = i.Args[n]
 			}
-			returnType := method.ReturnType
-			if returnType == "" {
-				returnType = "void"
+		}
+		for _, m := range i.Decl.Methods {
+			if !m.Abstract || seen[m.Name] {
+				continue
 			}
-
-			sb.WriteString(fmt.Sprintf("%s %s::%s(%s) {\n",
-				returnType,
-				typ.Name,
-				method.Name,
-				strings.Join(params, ", ")))
-
-			// Add default return statement
-			if returnType != "void" {
-				switch returnType {
-				case "int":
-					sb.WriteString("    return 0;\n")
-				case "double":
-					sb.WriteString("    return 0.0;\n")
-				case "string":
-					sb.WriteString("    return \"\";\n")
-				case "bool":
-					sb.WriteString("    return false;\n")
-				default:
-					sb.WriteString("    return {};\n")
-				}
+			seen[m.Name] = true
+			if impl := t.Base.LookupMethod(m.Name); impl != nil && !impl.Abstract {
+				list = append(list, cppForward{Slot: instantiate(m, bindings), Base: impl.Owner})
 			}
-
-			sb.WriteString("}\n\n")
-		}
-	}
-
-	// Generate standalone function implementations
-	for _, fn := range file.Functions {
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = fmt.Sprintf("%s %s", param.Type, param.Name)
-		}
-		returnType := fn.ReturnType
-		if returnType == "" {
-			returnType = "void"
 		}
-
-		sb.WriteString(fmt.Sprintf("%s %s(%s) {\n",
-			returnType,
-			fn.Name,
-			strings.Join(params, ", ")))
-
-		// Add default return statement
-		if returnType != "void" {
-			switch returnType {
-			case "int":
-				sb.WriteString("    return 0;\n")
-			case "double":
-				sb.WriteString("    return 0.0;\n")
-			case "string":
-				sb.WriteString("    return \"\";\n")
-			case "bool":
-				sb.WriteString("    return false;\n")
-			default:
-				sb.WriteString("    return {};\n")
-			}
+		for _, super := range i.Decl.Supers() {
+			visit(super.Substitute(bindings))
 		}
-
-		sb.WriteString("}\n\n")
 	}
+	for _, i := range t.Implements {
+		visit(i)
+	}
+	return list
+}
 
-	return sb.String()
+// instantiate returns a copy of m with bindings substituted into its
+// parameter and return types.
+func instantiate(m *ir.Function, bindings map[*ir.TypeParam]*ir.TypeRef) *ir.Function {
+	if len(bindings) == 0 {
+		return m
+	}
+	c := *m
+	c.Returns = m.Returns.Substitute(bindings)
+	c.Params = make([]*ir.Param, len(m.Params))
+	for n, p := range m.Params {
+		q := *p
+		q.Type = p.Type.Substitute(bindings)
+		c.Params[n] = &q
+	}
+	return &c
 }
@@ -2,153 +2,299 @@ package languages
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"go/format"
+	"path"
 	"strings"
+	"text/template"
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 )
 
 type GoGenerator struct {
-	config *types.Config
+	model    *ir.Model
+	layout   Layout
+	output   output.Sink
+	workers  Workers
+	renderer *renderer
 }
 
-func NewGoGenerator(config *types.Config) *GoGenerator {
-	return &GoGenerator{config: config}
+var goLayout = Layout{Source: "source/src"}
+
+func init() {
+	Register(Backend{
+		Name:    "go",
+		Aliases: []string{"golang"},
+		New:     func(model *ir.Model, opts Options) LanguageBackend { return NewGoGenerator(model, opts) },
+		Layout:  goLayout,
+	})
+}
+
+func NewGoGenerator(model *ir.Model, opts Options) *GoGenerator {
+	g := &GoGenerator{model: model, layout: opts.layout(model, goLayout), output: opts.Output, workers: opts.Workers}
+	g.renderer = newRenderer("go", opts, template.FuncMap{
+		"typeName":     g.goType,
+		"defaultValue": g.goDefaultValue,
+		"enumMember":   g.goEnumMember,
+		"initialValue": g.goInitialValue,
+		"funcDoc":      g.goFuncDoc,
+		"exportName":   g.exportName,
+		"typeParams":   g.goTypeParams,
+		"typeArgs":     g.goTypeArgs,
+		"results":      g.goResults,
+		"staticName":   g.goStaticName,
+	})
+	return g
 }
 
 func (g *GoGenerator) Generate() error {
-	for _, file := range g.config.Files {
-		path := filepath.Join(g.config.ProjectName, "source", "src", file.Name+".go")
-		content := g.generateContent(file)
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-			return err
+	var tasks []func() error
+	for _, file := range g.model.Files {
+		name := path.Join(g.layout.SourceDir(), file.Name+".go")
+		data := TemplateData{
+			Model:   g.model,
+			Package: strings.ToLower(g.model.Project),
+			File:    file,
 		}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			content, err := g.renderer.render("file", data)
+			if err != nil {
+				return "", err
+			}
+			return string(g.format(content)), nil
+		}))
 	}
-	return nil
+	return g.workers.run(tasks)
 }
 
-func (g *GoGenerator) generateContent(file types.FileConfig) string {
-	var sb strings.Builder
-
-	// Package declaration
-	sb.WriteString(fmt.Sprintf("package %s\n\n", strings.ToLower(g.config.ProjectName)))
-
-	// Generate struct definitions
-	for _, typ := range g.config.Types {
-		// Struct comment
-		sb.WriteString(fmt.Sprintf("// %s represents %s\n", typ.Name, typ.Name))
-		sb.WriteString(fmt.Sprintf("type %s struct {\n", typ.Name))
-
-		for _, field := range typ.Fields {
-			fieldName := field.Name
-			if field.Access == "public" {
-				fieldName = strings.Title(fieldName)
-			}
-			sb.WriteString(fmt.Sprintf("\t%s %s\n",
-				fieldName,
-				g.goType(field.Type)))
-		}
-		sb.WriteString("}\n\n")
-
-		// Generate methods
-		for _, method := range typ.Methods {
-			methodName := method.Name
-			if method.Access == "public" {
-				methodName = strings.Title(methodName)
-			}
+// format gofmts src, leaving it untouched if it does not parse so the
+// problem is visible in the output.
+func (g *GoGenerator) format(src string) []byte {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return []byte(src)
+	}
+	return formatted
+}
 
-			params := make([]string, len(method.Parameters))
-			for i, param := range method.Parameters {
-				params[i] = fmt.Sprintf("%s %s",
-					param.Name,
-					g.goType(param.Type))
-			}
+// exportName capitalizes name when access is public.
+func (g *GoGenerator) exportName(name string, access ir.Access) string {
+	if access.IsPublic() {
+		return strings.Title(name)
+	}
+	return name
+}
 
-			returnType := ""
-			if method.ReturnType != "" && method.ReturnType != "void" {
-				returnType = " " + g.goType(method.ReturnType)
-			}
+// goStaticName names the static member name of t, which Go declares at
+// package level: the type name followed by name, unexported unless
+// access is public.
+func (g *GoGenerator) goStaticName(t *ir.Type, name string, access ir.Access) string {
+	full := t.Name + strings.Title(name)
+	if access.IsPublic() {
+		return full
+	}
+	return strings.ToLower(full[:1]) + full[1:]
+}
 
-			sb.WriteString(fmt.Sprintf("func (t *%s) %s(%s)%s {\n",
-				typ.Name,
-				methodName,
-				strings.Join(params, ", "),
-				returnType))
+// goEnumMember prefixes enumerators with their type, as Go constants
+// share the package namespace.
+func (g *GoGenerator) goEnumMember(e *ir.Enum, v *ir.EnumValue) string {
+	return e.Name + g.exportName(v.Name, ir.Public)
+}
 
-			// Add default return statement if needed
-			if returnType != "" {
-				sb.WriteString(fmt.Sprintf("\treturn %s\n",
-					g.goDefaultValue(method.ReturnType)))
+func (g *GoGenerator) goType(t *ir.TypeRef) string {
+	if t.Alias != nil {
+		return t.Alias.Name
+	}
+	switch t.Kind {
+	case ir.Bool:
+		return "bool"
+	case ir.Char:
+		return "byte"
+	case ir.Int:
+		return "int"
+	case ir.Long:
+		return "int64"
+	case ir.Int8, ir.Int16, ir.Int32, ir.Int64, ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64:
+		return sizedInt(t)
+	case ir.Size:
+		return "uint"
+	case ir.Float:
+		return "float32"
+	case ir.Double:
+		return "float64"
+	case ir.String:
+		return "string"
+	case ir.Named:
+		if len(t.Args) > 0 {
+			args := make([]string, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = g.goType(arg)
 			}
-
-			sb.WriteString("}\n\n")
+			return t.Name + "[" + strings.Join(args, ", ") + "]"
+		}
+		return t.Name
+	case ir.List:
+		return "[]" + g.goType(t.Elem)
+	case ir.Array:
+		return fmt.Sprintf("[%d]%s", t.Len, g.goType(t.Elem))
+	case ir.Map:
+		return "map[" + g.goType(t.Key) + "]" + g.goType(t.Elem)
+	case ir.Reference:
+		// Slices and maps already have reference semantics
+		if t.Elem.Kind == ir.List || t.Elem.Kind == ir.Map {
+			return g.goType(t.Elem)
+		}
+		return "*" + g.goType(t.Elem)
+	case ir.Pointer, ir.Optional:
+		if t.Elem.Decl != nil && t.Elem.Decl.IsInterface() {
+			// Interface values are already references
+			return g.goType(t.Elem)
 		}
+		return "*" + g.goType(t.Elem)
+	case ir.Func:
+		args := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = g.goType(arg)
+		}
+		if t.Elem.IsVoid() {
+			return "func(" + strings.Join(args, ", ") + ")"
+		}
+		return "func(" + strings.Join(args, ", ") + ") " + g.goType(t.Elem)
+	default:
+		return ""
 	}
+}
 
-	// Generate standalone functions
-	for _, fn := range file.Functions {
-		fnName := fn.Name
-		if fn.Access == "public" {
-			fnName = strings.Title(fnName)
-		}
+// goFuncDoc is the doc comment of a function or constructor, each line
+// starting with indent, or "" when the config describes neither it nor
+// its parameters. Go has no tags for parameters, so they follow the
+// description as a list.
+func (g *GoGenerator) goFuncDoc(indent string, fn any) string {
+	var doc, returns string
+	var params []*ir.Param
+	var throws []*ir.ErrorType
+	switch fn := fn.(type) {
+	case *ir.Function:
+		doc, params, returns, throws = fn.Doc, fn.Params, fn.ReturnDoc, fn.Throws
+	case *ir.Constructor:
+		doc, params = fn.Doc, fn.Params
+	}
 
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = fmt.Sprintf("%s %s",
-				param.Name,
-				g.goType(param.Type))
+	var paragraphs []string
+	if doc != "" {
+		paragraphs = append(paragraphs, strings.TrimSpace(doc))
+	}
+	var list []string
+	for _, p := range params {
+		if p.Doc != "" {
+			list = append(list, "  - "+p.Name+": "+strings.ReplaceAll(strings.TrimSpace(p.Doc), "\n", "\n    "))
 		}
-
-		returnType := ""
-		if fn.ReturnType != "" && fn.ReturnType != "void" {
-			returnType = " " + g.goType(fn.ReturnType)
+	}
+	if len(list) > 0 {
+		paragraphs = append(paragraphs, "Parameters:\n"+strings.Join(list, "\n"))
+	}
+	if returns != "" {
+		paragraphs = append(paragraphs, "Returns: "+strings.TrimSpace(returns))
+	}
+	if len(throws) > 0 {
+		list = list[:0]
+		for _, e := range throws {
+			item := "  - *" + e.Name
+			if e.Doc != "" {
+				item += ": " + strings.ReplaceAll(strings.TrimSpace(e.Doc), "\n", "\n    ")
+			}
+			list = append(list, item)
 		}
+		paragraphs = append(paragraphs, "Errors:\n"+strings.Join(list, "\n"))
+	}
+	if len(paragraphs) == 0 {
+		return ""
+	}
+	return comment(indent+"// ", strings.Join(paragraphs, "\n\n"))
+}
 
-		sb.WriteString(fmt.Sprintf("func %s(%s)%s {\n",
-			fnName,
-			strings.Join(params, ", "),
-			returnType))
+// goResults is the result list of fn, with a leading space: its return
+// type, followed by an error when it throws.
+func (g *GoGenerator) goResults(fn *ir.Function) string {
+	switch {
+	case len(fn.Throws) == 0 && !fn.HasReturn():
+		return ""
+	case len(fn.Throws) == 0:
+		return " " + g.goType(fn.Returns)
+	case !fn.HasReturn():
+		return " error"
+	default:
+		return " (" + g.goType(fn.Returns) + ", error)"
+	}
+}
 
-		if returnType != "" {
-			sb.WriteString(fmt.Sprintf("\treturn %s\n",
-				g.goDefaultValue(fn.ReturnType)))
+// goTypeParams declares params, e.g. [K comparable, V any], or is ""
+// when there are none.
+func (g *GoGenerator) goTypeParams(params []*ir.TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	decls := make([]string, len(params))
+	for i, p := range params {
+		constraint := "any"
+		if p.Constraint != nil {
+			constraint = g.goType(p.Constraint)
 		}
-
-		sb.WriteString("}\n\n")
+		decls[i] = p.Name + " " + constraint
 	}
+	return "[" + strings.Join(decls, ", ") + "]"
+}
 
-	return sb.String()
+// goTypeArgs instantiates the generic type t with its own type
+// parameters, as in a method receiver, or is "" when t is not generic.
+func (g *GoGenerator) goTypeArgs(t *ir.Type) string {
+	if len(t.TypeParams) == 0 {
+		return ""
+	}
+	names := make([]string, len(t.TypeParams))
+	for i, p := range t.TypeParams {
+		names[i] = p.Name
+	}
+	return "[" + strings.Join(names, ", ") + "]"
 }
 
-func (g *GoGenerator) goType(typeStr string) string {
-	switch typeStr {
-	case "int":
-		return "int"
-	case "float", "double":
-		return "float64"
-	case "char*", "const char*", "string":
-		return "string"
-	case "bool":
-		return "bool"
+// goInitialValue is what New<Type> sets f to.
+func (g *GoGenerator) goInitialValue(f *ir.Field) string {
+	switch l := f.Default; {
+	case l == nil:
+		return g.goDefaultValue(f.Type)
+	case l.Enum != nil:
+		return g.goEnumMember(f.Type.Enum, l.Enum)
 	default:
-		if strings.Contains(typeStr, "*") {
-			return "*" + strings.TrimSuffix(typeStr, "*")
-		}
-		return typeStr
+		return literal(l)
 	}
 }
 
-func (g *GoGenerator) goDefaultValue(typeStr string) string {
-	switch g.goType(typeStr) {
-	case "int":
+func (g *GoGenerator) goDefaultValue(t *ir.TypeRef) string {
+	switch t.Kind {
+	case ir.Bool:
+		return "false"
+	case ir.Char, ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size:
 		return "0"
-	case "float64":
+	case ir.Float, ir.Double:
 		return "0.0"
-	case "string":
+	case ir.String:
 		return "\"\""
-	case "bool":
-		return "false"
+	case ir.Named:
+		if t.Enum != nil {
+			return g.goEnumMember(t.Enum, t.Enum.First())
+		}
+		if t.Decl != nil && t.Decl.IsInterface() {
+			return "nil"
+		}
+		if t.Param != nil {
+			return "*new(" + t.Name + ")"
+		}
+		return g.goType(t) + "{}"
+	case ir.Array:
+		return g.goType(t) + "{}"
 	default:
 		return "nil"
 	}
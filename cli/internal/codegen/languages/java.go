@@ -2,257 +2,305 @@ package languages
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
+	"sort"
 	"strings"
+	"text/template"
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 )
 
 type JavaGenerator struct {
-	config *types.Config
+	model    *ir.Model
+	layout   Layout
+	output   output.Sink
+	workers  Workers
+	renderer *renderer
 }
 
-func NewJavaGenerator(config *types.Config) *JavaGenerator {
-	return &JavaGenerator{config: config}
+var javaLayout = Layout{Source: "source/src/main/java", Package: PackagePath}
+
+func init() {
+	Register(Backend{
+		Name:   "java",
+		New:    func(model *ir.Model, opts Options) LanguageBackend { return NewJavaGenerator(model, opts) },
+		Layout: javaLayout,
+	})
+}
+
+func NewJavaGenerator(model *ir.Model, opts Options) *JavaGenerator {
+	g := &JavaGenerator{model: model, layout: opts.layout(model, javaLayout), output: opts.Output, workers: opts.Workers}
+	g.renderer = newRenderer("java", opts, template.FuncMap{
+		"typeName":     g.javaType,
+		"defaultValue": g.javaDefaultValue,
+		"enumMember":   g.javaEnumMember,
+		"initialValue": g.javaInitialValue,
+		"typeParams":   g.javaTypeParams,
+	})
+	return g
 }
 
 func (g *JavaGenerator) Generate() error {
 	// Create package directory
-	packageDir := filepath.Join(g.config.ProjectName, "source", "src", "main", "java",
-		strings.ToLower(g.config.ProjectName))
-	if err := os.MkdirAll(packageDir, 0755); err != nil {
+	packageName := strings.ToLower(g.model.Project)
+	packageDir := g.layout.SourceDir()
+	if g.layout.Package == PackagePath {
+		packageDir = path.Join(packageDir, strings.ReplaceAll(packageName, ".", "/"))
+	}
+	if err := g.output.MkdirAll(packageDir); err != nil {
 		return err
 	}
 
 	// Generate a file for each class
-	for _, typ := range g.config.Types {
-		path := filepath.Join(packageDir, typ.Name+".java")
-		content := g.generateClass(typ)
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-			return err
-		}
-	}
-
-	// Generate utility class for standalone functions
-	for _, file := range g.config.Files {
-		if len(file.Functions) > 0 {
-			path := filepath.Join(packageDir, file.Name+"Utils.java")
-			content := g.generateUtils(file)
-			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-func (g *JavaGenerator) generateClass(typ types.TypeConfig) string {
-	var sb strings.Builder
-
-	// Package declaration
-	packageName := strings.ToLower(g.config.ProjectName)
-	sb.WriteString(fmt.Sprintf("package %s;\n\n", packageName))
-
-	// Class JavaDoc
-	sb.WriteString(fmt.Sprintf("/**\n * %s class\n */\n", typ.Name))
-
-	// Class definition
-	sb.WriteString(fmt.Sprintf("public class %s {\n", typ.Name))
-
-	// Fields
-	for _, field := range typ.Fields {
-		access := field.Access
-		if access == "" {
-			access = "private"
-		}
-		sb.WriteString(fmt.Sprintf("    %s %s %s;\n",
-			access,
-			g.javaType(field.Type),
-			field.Name))
+	var tasks []func() error
+	for _, typ := range g.model.Types {
+		name := path.Join(packageDir, typ.Name+".java")
+		data := TemplateData{Model: g.model, Package: packageName, Type: typ, Imports: g.imports(typ.TypeRefs())}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			return g.renderer.render("class", data)
+		}))
 	}
-	sb.WriteString("\n")
 
-	// Default constructor
-	sb.WriteString(fmt.Sprintf("    public %s() {\n", typ.Name))
-	for _, field := range typ.Fields {
-		sb.WriteString(fmt.Sprintf("        this.%s = %s;\n",
-			field.Name,
-			g.javaDefaultValue(field.Type)))
+	// Generate a file for each enum
+	for _, enum := range g.model.Enums {
+		name := path.Join(packageDir, enum.Name+".java")
+		data := TemplateData{Model: g.model, Package: packageName, Enum: enum}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			return g.renderer.render("enum", data)
+		}))
 	}
-	sb.WriteString("    }\n\n")
-
-	// Getters and setters
-	for _, field := range typ.Fields {
-		// Getter
-		capitalizedField := strings.Title(field.Name)
-		javaType := g.javaType(field.Type)
 
-		sb.WriteString(fmt.Sprintf("    public %s get%s() {\n",
-			javaType,
-			capitalizedField))
-		sb.WriteString(fmt.Sprintf("        return %s;\n",
-			field.Name))
-		sb.WriteString("    }\n\n")
-
-		// Setter
-		sb.WriteString(fmt.Sprintf("    public void set%s(%s %s) {\n",
-			capitalizedField,
-			javaType,
-			field.Name))
-		sb.WriteString(fmt.Sprintf("        this.%s = %s;\n",
-			field.Name,
-			field.Name))
-		sb.WriteString("    }\n\n")
+	// Generate an exception class for each error
+	for _, e := range g.model.Errors {
+		name := path.Join(packageDir, e.Name+".java")
+		data := TemplateData{Model: g.model, Package: packageName, Error: e}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			return g.renderer.render("error", data)
+		}))
 	}
 
-	// Methods
-	for _, method := range typ.Methods {
-		access := method.Access
-		if access == "" {
-			access = "public"
+	// Generate a functional interface for each alias of a function
+	// type; other aliases are replaced by the type they stand for
+	for _, a := range g.model.Aliases {
+		if !a.Type.IsFunc() || a.Type.IsAlias() {
+			continue
 		}
+		name := path.Join(packageDir, a.Name+".java")
+		data := TemplateData{Model: g.model, Package: packageName, Alias: a, Imports: g.imports([]*ir.TypeRef{a.Type})}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			return g.renderer.render("alias", data)
+		}))
+	}
 
-		params := make([]string, len(method.Parameters))
-		for i, param := range method.Parameters {
-			params[i] = fmt.Sprintf("%s %s",
-				g.javaType(param.Type),
-				param.Name)
-		}
-
-		returnType := "void"
-		if method.ReturnType != "" && method.ReturnType != "void" {
-			returnType = g.javaType(method.ReturnType)
-		}
-
-		// Method JavaDoc
-		sb.WriteString("    /**\n")
-		for _, param := range method.Parameters {
-			sb.WriteString(fmt.Sprintf("     * @param %s the %s parameter\n",
-				param.Name,
-				param.Name))
-		}
-		if returnType != "void" {
-			sb.WriteString("     * @return the result\n")
-		}
-		sb.WriteString("     */\n")
-
-		sb.WriteString(fmt.Sprintf("    %s %s %s(%s) {\n",
-			access,
-			returnType,
-			method.Name,
-			strings.Join(params, ", ")))
-
-		if returnType != "void" {
-			sb.WriteString(fmt.Sprintf("        return %s;\n",
-				g.javaDefaultValue(method.ReturnType)))
+	// Generate utility class for standalone functions and variables
+	for _, file := range g.model.Files {
+		if len(file.Functions) > 0 || len(file.Variables) > 0 {
+			name := path.Join(packageDir, file.Name+"Utils.java")
+			data := TemplateData{Model: g.model, Package: packageName, File: file, Imports: g.imports(file.TypeRefs())}
+			tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+				return g.renderer.render("utils", data)
+			}))
 		}
-
-		sb.WriteString("    }\n\n")
 	}
 
-	sb.WriteString("}\n")
-	return sb.String()
+	return g.workers.run(tasks)
 }
 
-func (g *JavaGenerator) generateUtils(file types.FileConfig) string {
-	var sb strings.Builder
-
-	// Package declaration
-	packageName := strings.ToLower(g.config.ProjectName)
-	sb.WriteString(fmt.Sprintf("package %s;\n\n", packageName))
-
-	// Class JavaDoc
-	sb.WriteString(fmt.Sprintf("/**\n * Utility functions for %s\n */\n",
-		file.Name))
-
-	// Class definition
-	sb.WriteString(fmt.Sprintf("public class %sUtils {\n",
-		strings.Title(file.Name)))
-
-	// Private constructor to prevent instantiation
-	sb.WriteString(fmt.Sprintf("    private %sUtils() {\n",
-		strings.Title(file.Name)))
-	sb.WriteString("        // Utility class, no instantiation\n")
-	sb.WriteString("    }\n\n")
-
-	// Utility functions
-	for _, fn := range file.Functions {
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = fmt.Sprintf("%s %s",
-				g.javaType(param.Type),
-				param.Name)
-		}
-
-		returnType := "void"
-		if fn.ReturnType != "" && fn.ReturnType != "void" {
-			returnType = g.javaType(fn.ReturnType)
-		}
-
-		// Method JavaDoc
-		sb.WriteString("    /**\n")
-		for _, param := range fn.Parameters {
-			sb.WriteString(fmt.Sprintf("     * @param %s the %s parameter\n",
-				param.Name,
-				param.Name))
-		}
-		if returnType != "void" {
-			sb.WriteString("     * @return the result\n")
-		}
-		sb.WriteString("     */\n")
-
-		sb.WriteString(fmt.Sprintf("    public static %s %s(%s) {\n",
-			returnType,
-			fn.Name,
-			strings.Join(params, ", ")))
-
-		if returnType != "void" {
-			sb.WriteString(fmt.Sprintf("        return %s;\n",
-				g.javaDefaultValue(fn.ReturnType)))
+func (g *JavaGenerator) javaType(t *ir.TypeRef) string {
+	if t.IsAlias() && t.IsFunc() {
+		// Aliases of that alias share its interface
+		for t.Alias.Type.IsAlias() {
+			t = t.Alias.Type
 		}
-
-		sb.WriteString("    }\n\n")
+		return t.Alias.Name
 	}
-
-	sb.WriteString("}\n")
-	return sb.String()
-}
-
-func (g *JavaGenerator) javaType(typeStr string) string {
-	switch typeStr {
-	case "int":
+	switch t.Kind {
+	case ir.Void:
+		return "void"
+	case ir.Bool:
+		return "boolean"
+	case ir.Char:
+		return "char"
+	case ir.Int:
 		return "int"
-	case "float":
+	case ir.Long:
+		return "long"
+	case ir.Int8, ir.Uint8:
+		// Java has no unsigned types; unsigned values are kept in the
+		// signed type of the same width, as with Integer.toUnsignedLong
+		return "byte"
+	case ir.Int16, ir.Uint16:
+		return "short"
+	case ir.Int32, ir.Uint32:
+		return "int"
+	case ir.Int64, ir.Uint64, ir.Size:
+		return "long"
+	case ir.Float:
 		return "float"
-	case "double":
+	case ir.Double:
 		return "double"
-	case "char*", "const char*", "string":
+	case ir.String:
 		return "String"
-	case "bool":
-		return "boolean"
+	case ir.Named:
+		if len(t.Args) > 0 {
+			return t.Name + "<" + g.boxedTypes(t.Args...) + ">"
+		}
+		return t.Name
+	case ir.List:
+		return "List<" + g.boxedType(t.Elem) + ">"
+	case ir.Map:
+		return "Map<" + g.boxedTypes(t.Key, t.Elem) + ">"
+	case ir.Optional:
+		return "Optional<" + g.boxedType(t.Elem) + ">"
+	case ir.Array:
+		return g.javaType(t.Elem) + "[]"
+	case ir.Pointer:
+		return g.boxedType(t.Elem)
+	case ir.Reference:
+		return g.javaType(t.Elem)
 	default:
-		if strings.Contains(typeStr, "*") {
-			return strings.TrimSuffix(typeStr, "*")
+		return "Object"
+	}
+}
+
+// javaTypeParams declares params, e.g. <K, V extends Shape>, or is ""
+// when there are none.
+func (g *JavaGenerator) javaTypeParams(params []*ir.TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+		if p.Constraint != nil {
+			names[i] += " extends " + g.boxedType(p.Constraint)
 		}
-		return typeStr
 	}
+	return "<" + strings.Join(names, ", ") + ">"
 }
 
-func (g *JavaGenerator) javaDefaultValue(typeStr string) string {
-	switch g.javaType(typeStr) {
-	case "int":
+// boxedType is the reference type used where t may be null or is a
+// generic type argument.
+func (g *JavaGenerator) boxedType(t *ir.TypeRef) string {
+	switch t.Kind {
+	case ir.Bool:
+		return "Boolean"
+	case ir.Char:
+		return "Character"
+	case ir.Int:
+		return "Integer"
+	case ir.Long:
+		return "Long"
+	case ir.Int8, ir.Uint8:
+		return "Byte"
+	case ir.Int16, ir.Uint16:
+		return "Short"
+	case ir.Int32, ir.Uint32:
+		return "Integer"
+	case ir.Int64, ir.Uint64, ir.Size:
+		return "Long"
+	case ir.Float:
+		return "Float"
+	case ir.Double:
+		return "Double"
+	default:
+		return g.javaType(t)
+	}
+}
+
+func (g *JavaGenerator) boxedTypes(refs ...*ir.TypeRef) string {
+	names := make([]string, len(refs))
+	for i, r := range refs {
+		names[i] = g.boxedType(r)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (g *JavaGenerator) javaEnumMember(e *ir.Enum, v *ir.EnumValue) string {
+	return constant(v.Name)
+}
+
+func (g *JavaGenerator) javaDefaultValue(t *ir.TypeRef) string {
+	if t.Enum != nil {
+		return t.Name + "." + g.javaEnumMember(t.Enum, t.Enum.First())
+	}
+	switch t.Kind {
+	case ir.Bool:
+		return "false"
+	case ir.Char:
+		return "'\\0'"
+	case ir.Int, ir.Int8, ir.Int16, ir.Int32, ir.Uint8, ir.Uint16, ir.Uint32:
 		return "0"
-	case "float":
+	case ir.Long, ir.Int64, ir.Uint64, ir.Size:
+		return "0L"
+	case ir.Float:
 		return "0.0f"
-	case "double":
+	case ir.Double:
 		return "0.0"
-	case "String":
+	case ir.String:
 		return "\"\""
-	case "boolean":
-		return "false"
+	case ir.List:
+		return "new ArrayList<>()"
+	case ir.Map:
+		return "new HashMap<>()"
+	case ir.Optional:
+		return "Optional.empty()"
+	case ir.Array:
+		// Every length is given, outermost first: new double[3][2]
+		dims := ""
+		for ; t.Kind == ir.Array; t = t.Elem {
+			dims += fmt.Sprintf("[%d]", t.Len)
+		}
+		elem := g.javaType(t)
+		if i := strings.Index(elem, "<"); i >= 0 {
+			// Arrays of generic types cannot be created, only of
+			// their raw type
+			elem = elem[:i]
+		}
+		return "new " + elem + dims
+	case ir.Reference:
+		return g.javaDefaultValue(t.Elem)
 	default:
 		return "null"
 	}
 }
+
+// javaInitialValue is what the constructor without parameters assigns
+// to f.
+func (g *JavaGenerator) javaInitialValue(f *ir.Field) string {
+	switch l := f.Default; {
+	case l == nil:
+		return g.javaDefaultValue(f.Type)
+	case l.Enum != nil:
+		return f.Type.Name + "." + g.javaEnumMember(f.Type.Enum, l.Enum)
+	case f.Type.Kind == ir.Float:
+		return literal(l) + "f"
+	case g.javaType(f.Type) == "long":
+		return literal(l) + "L"
+	case f.Type.IsUnsigned() && l.Value.(int64) >= 1<<(f.Type.Bits()-1):
+		// Past the largest signed value, unsigned values wrap around
+		if f.Type.Bits() == 32 {
+			return "(int) " + literal(l) + "L"
+		}
+		return "(" + g.javaType(f.Type) + ") " + literal(l)
+	default:
+		return literal(l)
+	}
+}
+
+// imports lists the java.util classes refs need.
+func (g *JavaGenerator) imports(refs []*ir.TypeRef) []string {
+	var imports []string
+	if ir.Uses(refs, ir.List) {
+		imports = append(imports, "java.util.ArrayList", "java.util.List")
+	}
+	if ir.Uses(refs, ir.Map) {
+		imports = append(imports, "java.util.HashMap", "java.util.Map")
+	}
+	if ir.Uses(refs, ir.Optional) {
+		imports = append(imports, "java.util.Optional")
+	}
+	sort.Strings(imports)
+	return imports
+}
@@ -1,167 +1,158 @@
 package languages
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
+	"text/template"
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 )
 
 type JavaScriptGenerator struct {
-	config *types.Config
+	model    *ir.Model
+	layout   Layout
+	output   output.Sink
+	workers  Workers
+	renderer *renderer
 }
 
-func NewJavaScriptGenerator(config *types.Config) *JavaScriptGenerator {
-	return &JavaScriptGenerator{config: config}
+var javascriptLayout = Layout{Source: "source/src"}
+
+func init() {
+	Register(Backend{
+		Name:    "javascript",
+		Aliases: []string{"js"},
+		New:     func(model *ir.Model, opts Options) LanguageBackend { return NewJavaScriptGenerator(model, opts) },
+		Layout:  javascriptLayout,
+	})
+}
+
+func NewJavaScriptGenerator(model *ir.Model, opts Options) *JavaScriptGenerator {
+	g := &JavaScriptGenerator{model: model, layout: opts.layout(model, javascriptLayout), output: opts.Output, workers: opts.Workers}
+	g.renderer = newRenderer("javascript", opts, template.FuncMap{
+		"typeName":     g.jsDocType,
+		"defaultValue": g.jsDefaultValue,
+		"enumMember":   g.jsEnumMember,
+		"initialValue": g.jsInitialValue,
+		"templateTag":  g.jsTemplateTag,
+	})
+	return g
 }
 
 func (g *JavaScriptGenerator) Generate() error {
-	for _, file := range g.config.Files {
-		path := filepath.Join(g.config.ProjectName, "source", "src", file.Name+".js")
-		content := g.generateContent(file)
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-			return err
-		}
+	var tasks []func() error
+	for _, file := range g.model.Files {
+		name := path.Join(g.layout.SourceDir(), file.Name+".js")
+		data := TemplateData{Model: g.model, File: file}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			return g.renderer.render("module", data)
+		}))
 	}
-	return nil
+	return g.workers.run(tasks)
 }
 
-func (g *JavaScriptGenerator) generateContent(file types.FileConfig) string {
-	var sb strings.Builder
-
-	// Add JSDoc types for better IDE support
-	sb.WriteString("/**\n * @typedef {Object} Types\n")
-	for _, typ := range g.config.Types {
-		sb.WriteString(fmt.Sprintf(" * @typedef {Object} %s\n", typ.Name))
-		for _, field := range typ.Fields {
-			sb.WriteString(fmt.Sprintf(" * @property {%s} %s\n",
-				g.jsDocType(field.Type),
-				field.Name))
-		}
+// jsTemplateTag is the JSDoc @template tag declaring p.
+func (g *JavaScriptGenerator) jsTemplateTag(p *ir.TypeParam) string {
+	tag := "@template "
+	if p.Constraint != nil {
+		tag += "{" + g.jsDocType(p.Constraint) + "} "
 	}
-	sb.WriteString(" */\n\n")
-
-	// Generate class definitions
-	for _, typ := range g.config.Types {
-		sb.WriteString(fmt.Sprintf("class %s {\n", typ.Name))
+	return tag + p.Name + " " + p.Doc
+}
 
-		// Constructor
-		sb.WriteString("    constructor() {\n")
-		for _, field := range typ.Fields {
-			sb.WriteString(fmt.Sprintf("        /**\n         * @type {%s}\n         */\n",
-				g.jsDocType(field.Type)))
-			sb.WriteString(fmt.Sprintf("        this.%s = %s;\n",
-				field.Name,
-				g.jsDefaultValue(field.Type)))
+func (g *JavaScriptGenerator) jsDocType(t *ir.TypeRef) string {
+	if t.Alias != nil {
+		return t.Alias.Name
+	}
+	switch t.Kind {
+	case ir.Void:
+		return "void"
+	case ir.Bool:
+		return "boolean"
+	case ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size,
+		ir.Float, ir.Double:
+		return "number"
+	case ir.Char, ir.String:
+		return "string"
+	case ir.Named:
+		if t.Decl == nil && t.Enum == nil && t.Param == nil {
+			return "*"
 		}
-		sb.WriteString("    }\n\n")
-
-		// Generate methods
-		for _, method := range typ.Methods {
-			// JSDoc for method
-			sb.WriteString("    /**\n")
-			for _, param := range method.Parameters {
-				sb.WriteString(fmt.Sprintf("     * @param {%s} %s\n",
-					g.jsDocType(param.Type),
-					param.Name))
-			}
-			if method.ReturnType != "" && method.ReturnType != "void" {
-				sb.WriteString(fmt.Sprintf("     * @returns {%s}\n",
-					g.jsDocType(method.ReturnType)))
-			}
-			sb.WriteString("     */\n")
-
-			params := make([]string, len(method.Parameters))
-			for i, param := range method.Parameters {
-				params[i] = param.Name
+		if len(t.Args) > 0 {
+			args := make([]string, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = g.jsDocType(arg)
 			}
-
-			sb.WriteString(fmt.Sprintf("    %s(%s) {\n",
-				method.Name,
-				strings.Join(params, ", ")))
-
-			if method.ReturnType != "" && method.ReturnType != "void" {
-				sb.WriteString(fmt.Sprintf("        return %s;\n",
-					g.jsDefaultValue(method.ReturnType)))
-			}
-
-			sb.WriteString("    }\n\n")
-		}
-
-		sb.WriteString("}\n\n")
-	}
-
-	// Generate standalone functions
-	for _, fn := range file.Functions {
-		// JSDoc for function
-		sb.WriteString("/**\n")
-		for _, param := range fn.Parameters {
-			sb.WriteString(fmt.Sprintf(" * @param {%s} %s\n",
-				g.jsDocType(param.Type),
-				param.Name))
+			return t.Name + "<" + strings.Join(args, ", ") + ">"
 		}
-		if fn.ReturnType != "" && fn.ReturnType != "void" {
-			sb.WriteString(fmt.Sprintf(" * @returns {%s}\n",
-				g.jsDocType(fn.ReturnType)))
+		return t.Name
+	case ir.List, ir.Array:
+		elem := g.jsDocType(t.Elem)
+		if strings.Contains(elem, "|") {
+			elem = "(" + elem + ")"
 		}
-		sb.WriteString(" */\n")
-
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = param.Name
+		return elem + "[]"
+	case ir.Map:
+		return "Map<" + g.jsDocType(t.Key) + ", " + g.jsDocType(t.Elem) + ">"
+	case ir.Optional, ir.Pointer:
+		return g.jsDocType(t.Elem) + "|null"
+	case ir.Reference:
+		return g.jsDocType(t.Elem)
+	case ir.Func:
+		args := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = g.jsDocType(arg)
 		}
-
-		sb.WriteString(fmt.Sprintf("function %s(%s) {\n",
-			fn.Name,
-			strings.Join(params, ", ")))
-
-		if fn.ReturnType != "" && fn.ReturnType != "void" {
-			sb.WriteString(fmt.Sprintf("    return %s;\n",
-				g.jsDefaultValue(fn.ReturnType)))
+		if t.Elem.IsVoid() {
+			return "function(" + strings.Join(args, ", ") + ")"
 		}
-
-		sb.WriteString("}\n\n")
-	}
-
-	// Export all classes and functions
-	sb.WriteString("module.exports = {\n")
-	for _, typ := range g.config.Types {
-		sb.WriteString(fmt.Sprintf("    %s,\n", typ.Name))
-	}
-	for _, fn := range file.Functions {
-		sb.WriteString(fmt.Sprintf("    %s,\n", fn.Name))
+		return "function(" + strings.Join(args, ", ") + "): " + g.jsDocType(t.Elem)
+	default:
+		return "*"
 	}
-	sb.WriteString("};\n")
+}
 
-	return sb.String()
+func (g *JavaScriptGenerator) jsEnumMember(e *ir.Enum, v *ir.EnumValue) string {
+	return constant(v.Name)
 }
 
-func (g *JavaScriptGenerator) jsDocType(typeStr string) string {
-	switch typeStr {
-	case "int", "float", "double":
-		return "number"
-	case "char*", "const char*", "string":
-		return "string"
-	case "bool":
-		return "boolean"
-	default:
-		if strings.Contains(typeStr, "*") {
-			return strings.TrimSuffix(typeStr, "*") + "|null"
-		}
-		return typeStr
+// jsInitialValue is what the constructor assigns to f.
+func (g *JavaScriptGenerator) jsInitialValue(f *ir.Field) string {
+	l := f.Default
+	switch {
+	case l == nil:
+		return g.jsDefaultValue(f.Type)
+	case l.Enum != nil:
+		return f.Type.Name + "." + g.jsEnumMember(f.Type.Enum, l.Enum)
+	}
+	if r, ok := l.Value.(rune); ok {
+		return strconv.Quote(string(r))
 	}
+	return literal(l)
 }
 
-func (g *JavaScriptGenerator) jsDefaultValue(typeStr string) string {
-	switch g.jsDocType(typeStr) {
-	case "number":
+func (g *JavaScriptGenerator) jsDefaultValue(t *ir.TypeRef) string {
+	if t.Enum != nil {
+		return t.Name + "." + g.jsEnumMember(t.Enum, t.Enum.First())
+	}
+	switch t.Kind {
+	case ir.Bool:
+		return "false"
+	case ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size,
+		ir.Float, ir.Double:
 		return "0"
-	case "string":
+	case ir.Char, ir.String:
 		return "''"
-	case "boolean":
-		return "false"
+	case ir.List, ir.Array:
+		return "[]"
+	case ir.Map:
+		return "new Map()"
+	case ir.Reference:
+		return g.jsDefaultValue(t.Elem)
 	default:
 		return "null"
 	}
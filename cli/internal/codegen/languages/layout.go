@@ -0,0 +1,58 @@
+package languages
+
+import "path"
+
+// Layout places a backend's output below the output directory.
+type Layout struct {
+	// Root is the backend's directory. Defaults to the project name.
+	Root string
+
+	// Source holds source files, relative to Root.
+	Source string
+
+	// Include holds header files, relative to Root. Only C and C++
+	// generate headers; it is empty for every other backend.
+	Include string
+
+	// Package is how Java sources are nested below Source: PackagePath
+	// gives each package component a directory, PackageFlat puts them
+	// directly in Source. Empty for backends without packages.
+	Package string
+}
+
+// Package directory styles.
+const (
+	PackagePath = "path"
+	PackageFlat = "flat"
+)
+
+// Merge fills the empty fields of l from defaults.
+func (l Layout) Merge(defaults Layout) Layout {
+	if l.Root == "" {
+		l.Root = defaults.Root
+	}
+	if l.Source == "" {
+		l.Source = defaults.Source
+	}
+	if l.Include == "" {
+		l.Include = defaults.Include
+	}
+	if l.Package == "" {
+		l.Package = defaults.Package
+	}
+	return l
+}
+
+// SourceDir is the directory of source files below the output directory.
+func (l Layout) SourceDir() string {
+	return path.Join(l.Root, l.Source)
+}
+
+// IncludeDir is the directory of header files below the output
+// directory, or "" for backends without headers.
+func (l Layout) IncludeDir() string {
+	if l.Include == "" {
+		return ""
+	}
+	return path.Join(l.Root, l.Include)
+}
@@ -0,0 +1,32 @@
+package languages
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+)
+
+// literal spells the non-enum literal l the way most backends share:
+// quoted strings and chars, and floating point numbers that always have
+// a decimal point or exponent. Backends add suffixes and adjust the rest.
+func literal(l *ir.Literal) string {
+	switch v := l.Value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case rune:
+		return strconv.QuoteRune(v)
+	case string:
+		return strconv.Quote(v)
+	default:
+		return ""
+	}
+}
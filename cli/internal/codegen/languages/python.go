@@ -1,143 +1,324 @@
 package languages
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
+	"text/template"
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
 )
 
 type PythonGenerator struct {
-	config *types.Config
+	model    *ir.Model
+	layout   Layout
+	output   output.Sink
+	workers  Workers
+	renderer *renderer
 }
 
-func NewPythonGenerator(config *types.Config) *PythonGenerator {
-	return &PythonGenerator{config: config}
+var pythonLayout = Layout{Source: "source/src"}
+
+func init() {
+	Register(Backend{
+		Name:    "python",
+		Aliases: []string{"py"},
+		New:     func(model *ir.Model, opts Options) LanguageBackend { return NewPythonGenerator(model, opts) },
+		Layout:  pythonLayout,
+	})
+}
+
+func NewPythonGenerator(model *ir.Model, opts Options) *PythonGenerator {
+	g := &PythonGenerator{model: model, layout: opts.layout(model, pythonLayout), output: opts.Output, workers: opts.Workers}
+	g.renderer = newRenderer("python", opts, template.FuncMap{
+		"typeName":     g.pythonType,
+		"defaultValue": g.pythonDefaultValue,
+		"enumMember":   g.pythonEnumMember,
+		"initialValue": g.pythonInitialValue,
+		"docstring":    g.pythonDocstring,
+		"bases":        g.pythonBases,
+		"typeVars":     g.pythonTypeVars,
+		"typing":       g.pythonTyping,
+	})
+	return g
 }
 
 func (g *PythonGenerator) Generate() error {
-	for _, file := range g.config.Files {
-		path := filepath.Join(g.config.ProjectName, "source", "src", file.Name+".py")
-		content := g.generateContent(file)
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-			return err
-		}
+	var tasks []func() error
+	for _, file := range g.model.Files {
+		name := path.Join(g.layout.SourceDir(), file.Name+".py")
+		data := TemplateData{Model: g.model, File: file}
+		tasks = append(tasks, writeTask(g.output, name, func() (string, error) {
+			return g.renderer.render("module", data)
+		}))
 	}
-	return nil
+	return g.workers.run(tasks)
 }
 
-func (g *PythonGenerator) generateContent(file types.FileConfig) string {
-	var sb strings.Builder
-
-	sb.WriteString("#!/usr/bin/env python3\n")
-	sb.WriteString("from typing import List, Optional, Dict, Any\n\n")
+func (g *PythonGenerator) pythonType(t *ir.TypeRef) string {
+	if t.Alias != nil {
+		return t.Alias.Name
+	}
+	switch t.Kind {
+	case ir.Void:
+		return "None"
+	case ir.Bool:
+		return "bool"
+	case ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size:
+		return "int"
+	case ir.Float, ir.Double:
+		return "float"
+	case ir.Char, ir.String:
+		return "str"
+	case ir.Named:
+		if t.Decl == nil && t.Enum == nil && t.Param == nil {
+			return "Any"
+		}
+		if len(t.Args) > 0 {
+			args := make([]string, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = g.pythonType(arg)
+			}
+			return t.Name + "[" + strings.Join(args, ", ") + "]"
+		}
+		return t.Name
+	case ir.List, ir.Array:
+		return "List[" + g.pythonType(t.Elem) + "]"
+	case ir.Map:
+		return "Dict[" + g.pythonType(t.Key) + ", " + g.pythonType(t.Elem) + "]"
+	case ir.Optional, ir.Pointer:
+		return "Optional[" + g.pythonType(t.Elem) + "]"
+	case ir.Reference:
+		return g.pythonType(t.Elem)
+	case ir.Func:
+		args := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = g.pythonType(arg)
+		}
+		return "Callable[[" + strings.Join(args, ", ") + "], " + g.pythonType(t.Elem) + "]"
+	default:
+		return "Any"
+	}
+}
 
-	// Generate class definitions
-	for _, typ := range g.config.Types {
-		sb.WriteString(fmt.Sprintf("class %s:\n", typ.Name))
+// pythonTyping lists the names the module of file imports from typing.
+func (g *PythonGenerator) pythonTyping(file *ir.File) []string {
+	names := []string{"List", "Optional", "Dict", "Any"}
+	if len(file.TypeParams()) > 0 {
+		names = append(names, "Generic", "TypeVar")
+	}
+	if file.HasStatics() {
+		names = append(names, "ClassVar", "Final")
+	}
+	if file.Uses(ir.Func) {
+		names = append(names, "Callable")
+	}
+	if len(file.Aliases) > 0 {
+		names = append(names, "TypeAlias")
+	}
+	return names
+}
 
-		// Generate constructor with type hints
-		sb.WriteString("    def __init__(self):\n")
-		if len(typ.Fields) == 0 {
-			sb.WriteString("        pass\n")
+// pythonBases is the parenthesized base class list of t, or "" when it
+// has none. Generic types also derive from Generic. Type arguments of
+// generic interfaces that name classes are quoted, as t itself and the
+// classes after it are not defined yet when its bases are evaluated.
+func (g *PythonGenerator) pythonBases(t *ir.Type) string {
+	var bases []string
+	for _, super := range t.Supers() {
+		base := super.Name
+		if len(super.Args) > 0 {
+			args := make([]string, len(super.Args))
+			for i, arg := range super.Args {
+				args[i] = g.pythonType(arg)
+				if arg.Uses(ir.Named) {
+					args[i] = strconv.Quote(args[i])
+				}
+			}
+			base += "[" + strings.Join(args, ", ") + "]"
 		}
-		for _, field := range typ.Fields {
-			sb.WriteString(fmt.Sprintf("        self.%s: %s = %s\n",
-				field.Name,
-				g.pythonType(field.Type),
-				g.pythonDefaultValue(field.Type)))
+		bases = append(bases, base)
+	}
+	if len(bases) == 0 && t.Abstract {
+		bases = append(bases, "ABC")
+	}
+	if len(t.TypeParams) > 0 {
+		names := make([]string, len(t.TypeParams))
+		for i, p := range t.TypeParams {
+			names[i] = p.Name
 		}
-		sb.WriteString("\n")
-
-		// Generate methods
-		for _, method := range typ.Methods {
-			params := []string{"self"}
-			for _, param := range method.Parameters {
-				params = append(params, fmt.Sprintf("%s: %s",
-					param.Name,
-					g.pythonType(param.Type)))
-			}
+		bases = append(bases, "Generic["+strings.Join(names, ", ")+"]")
+	}
+	if len(bases) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(bases, ", ") + ")"
+}
 
-			returnHint := ""
-			if method.ReturnType != "" && method.ReturnType != "void" {
-				returnHint = " -> " + g.pythonType(method.ReturnType)
-			}
+// pythonTypeVars declares a TypeVar for each type parameter name used in
+// file, in order of first use.
+func (g *PythonGenerator) pythonTypeVars(file *ir.File) []string {
+	var decls []string
+	seen := map[string]bool{}
+	for _, p := range file.TypeParams() {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		decl := p.Name + " = TypeVar(" + strconv.Quote(p.Name)
+		if p.Constraint != nil {
+			decl += ", bound=" + strconv.Quote(g.pythonType(p.Constraint))
+		}
+		decls = append(decls, decl+")")
+	}
+	return decls
+}
 
-			sb.WriteString(fmt.Sprintf("    def %s(%s)%s:\n",
-				method.Name,
-				strings.Join(params, ", "),
-				returnHint))
+func (g *PythonGenerator) pythonEnumMember(e *ir.Enum, v *ir.EnumValue) string {
+	return constant(v.Name)
+}
 
-			// Add default return statement if needed
-			if method.ReturnType != "" && method.ReturnType != "void" {
-				sb.WriteString(fmt.Sprintf("        return %s\n\n",
-					g.pythonDefaultValue(method.ReturnType)))
+// pythonDocstring is the Google style docstring of a file, type, enum,
+// error, function or constructor, each line starting with indent, or ""
+// when the config describes nothing in it.
+func (g *PythonGenerator) pythonDocstring(indent string, v any) string {
+	var doc string
+	var sections []string
+	switch v := v.(type) {
+	case *ir.File:
+		doc = v.Doc
+	case *ir.Type:
+		doc = v.Doc
+		var attrs []string
+		for _, f := range v.Statics {
+			attrs = g.docItem(attrs, fieldName(f), f.Doc)
+		}
+		for _, f := range v.Fields {
+			attrs = g.docItem(attrs, f.Name, f.Doc)
+		}
+		sections = g.docSection(sections, "Attributes", attrs)
+	case *ir.Enum:
+		doc = v.Doc
+		var attrs []string
+		for _, ev := range v.Values {
+			attrs = g.docItem(attrs, g.pythonEnumMember(v, ev), ev.Doc)
+		}
+		sections = g.docSection(sections, "Attributes", attrs)
+	case *ir.Function:
+		doc = v.Doc
+		sections = g.docSection(sections, "Args", g.docParams(v.Params))
+		if v.ReturnDoc != "" {
+			returns := strings.ReplaceAll(strings.TrimSpace(v.ReturnDoc), "\n", "\n    ")
+			sections = g.docSection(sections, "Returns", []string{returns})
+		}
+		var raises []string
+		for _, e := range v.Throws {
+			if e.Doc == "" {
+				raises = append(raises, e.Name)
 			} else {
-				sb.WriteString("        pass\n\n")
+				raises = g.docItem(raises, e.Name, e.Doc)
 			}
 		}
+		sections = g.docSection(sections, "Raises", raises)
+	case *ir.ErrorType:
+		doc = v.Doc
+	case *ir.Constructor:
+		doc = v.Doc
+		sections = g.docSection(sections, "Args", g.docParams(v.Params))
 	}
 
-	// Generate standalone functions
-	for _, fn := range file.Functions {
-		params := make([]string, len(fn.Parameters))
-		for i, param := range fn.Parameters {
-			params[i] = fmt.Sprintf("%s: %s",
-				param.Name,
-				g.pythonType(param.Type))
+	doc = strings.TrimSpace(doc)
+	if len(sections) == 0 && !strings.Contains(doc, "\n") {
+		if doc == "" {
+			return ""
 		}
+		return indent + `"""` + g.escapeDoc(doc) + `"""`
+	}
+	var paragraphs []string
+	if doc != "" {
+		paragraphs = append(paragraphs, doc)
+	}
+	paragraphs = append(paragraphs, sections...)
+	body := comment(indent, g.escapeDoc(strings.Join(paragraphs, "\n\n")))
+	return indent + `"""` + strings.TrimPrefix(body, indent) + "\n" + indent + `"""`
+}
 
-		returnHint := ""
-		if fn.ReturnType != "" && fn.ReturnType != "void" {
-			returnHint = " -> " + g.pythonType(fn.ReturnType)
-		}
+func (g *PythonGenerator) docParams(params []*ir.Param) []string {
+	var items []string
+	for _, p := range params {
+		items = g.docItem(items, p.Name, p.Doc)
+	}
+	return items
+}
 
-		sb.WriteString(fmt.Sprintf("def %s(%s)%s:\n",
-			fn.Name,
-			strings.Join(params, ", "),
-			returnHint))
+// docItem adds "name: doc" to items when doc is given, indenting its
+// continuation lines.
+func (g *PythonGenerator) docItem(items []string, name, doc string) []string {
+	if doc == "" {
+		return items
+	}
+	return append(items, name+": "+strings.ReplaceAll(strings.TrimSpace(doc), "\n", "\n    "))
+}
 
-		if fn.ReturnType != "" && fn.ReturnType != "void" {
-			sb.WriteString(fmt.Sprintf("    return %s\n\n",
-				g.pythonDefaultValue(fn.ReturnType)))
-		} else {
-			sb.WriteString("    pass\n\n")
-		}
+// docSection adds a section headed title to sections when it has items.
+func (g *PythonGenerator) docSection(sections []string, title string, items []string) []string {
+	if len(items) == 0 {
+		return sections
 	}
+	return append(sections, title+":\n    "+strings.Join(items, "\n    "))
+}
 
-	return sb.String()
+// escapeDoc keeps backslashes and triple quotes in s from ending or
+// changing a docstring.
+func (g *PythonGenerator) escapeDoc(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `"""`, `\"\"\"`)
 }
 
-func (g *PythonGenerator) pythonType(cType string) string {
-	switch cType {
-	case "int":
-		return "int"
-	case "float", "double":
-		return "float"
-	case "char*", "const char*", "string":
-		return "str"
-	case "bool":
-		return "bool"
-	default:
-		if strings.Contains(cType, "*") {
-			return "Optional[" + strings.TrimSuffix(cType, "*") + "]"
+// pythonInitialValue is what __init__ assigns to f.
+func (g *PythonGenerator) pythonInitialValue(f *ir.Field) string {
+	l := f.Default
+	switch {
+	case l == nil:
+		return g.pythonDefaultValue(f.Type)
+	case l.Enum != nil:
+		return f.Type.Name + "." + g.pythonEnumMember(f.Type.Enum, l.Enum)
+	}
+	switch v := l.Value.(type) {
+	case bool:
+		if v {
+			return "True"
 		}
-		return "Any"
+		return "False"
+	case rune:
+		return strconv.Quote(string(v))
+	default:
+		return literal(l)
 	}
 }
 
-func (g *PythonGenerator) pythonDefaultValue(cType string) string {
-	switch g.pythonType(cType) {
-	case "int":
+func (g *PythonGenerator) pythonDefaultValue(t *ir.TypeRef) string {
+	if t.Enum != nil {
+		return t.Name + "." + g.pythonEnumMember(t.Enum, t.Enum.First())
+	}
+	switch t.Kind {
+	case ir.Bool:
+		return "False"
+	case ir.Int, ir.Long, ir.Int8, ir.Int16, ir.Int32, ir.Int64,
+		ir.Uint8, ir.Uint16, ir.Uint32, ir.Uint64, ir.Size:
 		return "0"
-	case "float":
+	case ir.Float, ir.Double:
 		return "0.0"
-	case "str":
+	case ir.Char, ir.String:
 		return "\"\""
-	case "bool":
-		return "False"
+	case ir.List, ir.Array:
+		return "[]"
+	case ir.Map:
+		return "{}"
+	case ir.Reference:
+		return g.pythonDefaultValue(t.Elem)
 	default:
 		return "None"
 	}
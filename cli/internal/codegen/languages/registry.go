@@ -0,0 +1,64 @@
+package languages
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+)
+
+// LanguageBackend generates source code for one target language.
+type LanguageBackend interface {
+	Generate() error
+}
+
+// Backend describes a registered language backend and the names it answers to.
+type Backend struct {
+	Name    string
+	Aliases []string
+	New     func(model *ir.Model, opts Options) LanguageBackend
+
+	// Layout is where the backend writes unless configured otherwise.
+	// Its Include and Package fields tell whether the backend generates
+	// headers and packages at all.
+	Layout Layout
+}
+
+var (
+	backends = map[string]*Backend{}
+	lookup   = map[string]*Backend{}
+)
+
+// Register makes a backend available under its name and aliases.
+// It panics if any of those names is already taken.
+func Register(b Backend) {
+	if b.Name == "" || b.New == nil {
+		panic("languages: Register called with incomplete backend")
+	}
+	entry := &b
+	for _, name := range append([]string{b.Name}, b.Aliases...) {
+		key := strings.ToLower(name)
+		if _, dup := lookup[key]; dup {
+			panic(fmt.Sprintf("languages: backend %q registered twice", key))
+		}
+		lookup[key] = entry
+	}
+	backends[strings.ToLower(b.Name)] = entry
+}
+
+// Lookup finds a backend by name or alias, ignoring case.
+func Lookup(name string) (*Backend, bool) {
+	b, ok := lookup[strings.ToLower(name)]
+	return b, ok
+}
+
+// Backends returns every registered backend sorted by name.
+func Backends() []*Backend {
+	list := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,192 @@
+package languages
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
+)
+
+//go:embed templates/*/*.tmpl
+var builtinTemplates embed.FS
+
+// Options configures how a backend renders its output.
+type Options struct {
+	// TemplateDir is searched for <language>/<name>.tmpl files that
+	// replace the built-in template of the same name. Templates missing
+	// from the directory fall back to the built-in ones.
+	TemplateDir string
+
+	// Output receives every generated file.
+	Output output.Sink
+
+	// Layout places the generated files. Empty fields take the
+	// backend's defaults.
+	Layout Layout
+
+	// Workers limits how many files are rendered concurrently. Nil
+	// renders them one at a time.
+	Workers Workers
+}
+
+func (o Options) layout(model *ir.Model, defaults Layout) Layout {
+	layout := o.Layout.Merge(defaults)
+	if layout.Root == "" {
+		layout.Root = model.Project
+	}
+	return layout
+}
+
+// TemplateData is the value every template is executed with.
+type TemplateData struct {
+	Model   *ir.Model
+	Package string
+	File    *ir.File
+	Type    *ir.Type
+	Enum    *ir.Enum
+	Error   *ir.ErrorType
+	Alias   *ir.Alias
+
+	// Imports lists what the rendered file needs to import or include.
+	Imports []string
+}
+
+// renderer loads and executes the templates of a single backend.
+type renderer struct {
+	lang  string
+	opts  Options
+	funcs template.FuncMap
+
+	mu    sync.Mutex
+	cache map[string]*template.Template
+}
+
+func newRenderer(lang string, opts Options, funcs template.FuncMap) *renderer {
+	merged := template.FuncMap{
+		"title":     strings.Title,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"constant":  constant,
+		"quote":     strconv.Quote,
+		"comment":   comment,
+		"docBlock":  docBlock,
+		"join":      strings.Join,
+		"fieldName": fieldName,
+	}
+	for name, fn := range funcs {
+		merged[name] = fn
+	}
+	return &renderer{
+		lang:  lang,
+		opts:  opts,
+		funcs: merged,
+		cache: map[string]*template.Template{},
+	}
+}
+
+// constant spells name in upper snake case, so "notStarted",
+// "NotStarted" and "not_started" all become "NOT_STARTED".
+func constant(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// fieldName is the declared name of a static field or file variable:
+// its name, or its name in upper snake case for a constant.
+func fieldName(f *ir.Field) string {
+	if f.Const {
+		return constant(f.Name)
+	}
+	return f.Name
+}
+
+// comment prefixes every line of the description s with prefix, for doc
+// comments spanning several lines. "*/" is broken up so a description
+// cannot end a block comment early.
+func comment(prefix, s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "*/", "* /")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(prefix+line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// docBlock is a /** */ comment holding the description s, indented by
+// indent, on a single line when s has one.
+func docBlock(indent, s string) string {
+	if !strings.Contains(strings.TrimSpace(s), "\n") {
+		return indent + "/** " + comment("", s) + " */"
+	}
+	return indent + "/**\n" + comment(indent+" * ", s) + "\n" + indent + " */"
+}
+
+// render executes the named template with data.
+func (r *renderer) render(name string, data TemplateData) (string, error) {
+	tmpl, err := r.load(name)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%s/%s.tmpl: %w", r.lang, name, err)
+	}
+	return buf.String(), nil
+}
+
+func (r *renderer) load(name string) (*template.Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tmpl, ok := r.cache[name]; ok {
+		return tmpl, nil
+	}
+
+	file := r.lang + "/" + name + ".tmpl"
+	src, err := r.source(file)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(file).Funcs(r.funcs).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	r.cache[name] = tmpl
+	return tmpl, nil
+}
+
+// source returns the override for file if one exists, else the built-in.
+func (r *renderer) source(file string) ([]byte, error) {
+	if r.opts.TemplateDir != "" {
+		src, err := os.ReadFile(filepath.Join(r.opts.TemplateDir, filepath.FromSlash(file)))
+		if err == nil {
+			return src, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return builtinTemplates.ReadFile("templates/" + file)
+}
@@ -0,0 +1,63 @@
+package languages
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
+)
+
+// Workers bounds how many files are rendered at once. A single value can
+// be shared by several backends so the limit holds across languages.
+type Workers chan struct{}
+
+// NewWorkers allows n files to be rendered at once; n <= 0 means one per
+// CPU.
+func NewWorkers(n int) Workers {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return make(Workers, n)
+}
+
+// run calls every task, at most cap(w) at a time, and waits for all of
+// them. Errors are joined in task order so the result does not depend on
+// scheduling. A nil Workers runs the tasks one after another.
+func (w Workers) run(tasks []func() error) error {
+	errs := make([]error, len(tasks))
+	if w == nil {
+		for i, task := range tasks {
+			errs[i] = task()
+		}
+		return errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		w <- struct{}{}
+		go func() {
+			defer func() {
+				<-w
+				wg.Done()
+			}()
+			errs[i] = task()
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// writeTask returns a task that renders one file and writes it to out
+// under name.
+func writeTask(out output.Sink, name string, render func() (string, error)) func() error {
+	return func() error {
+		content, err := render()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return out.WriteFile(name, []byte(content))
+	}
+}
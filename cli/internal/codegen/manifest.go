@@ -0,0 +1,176 @@
+package codegen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/regions"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// ManifestName is the file, inside the project directory, recording what
+// the last run generated.
+const ManifestName = ".manifest.json"
+
+// Manifest lists every file a run generated with the SHA-256 of its
+// contents, so later runs can tell generated files from hand-edited ones
+// and find files that are no longer generated. Regions holds, per file,
+// the SHA-256 of the stub generated for each protected region: the file
+// written carries hand-written region bodies over, so its hash alone
+// cannot tell them from generated code.
+type Manifest struct {
+	Config  string                       `json:"config"`
+	Dirs    []string                     `json:"dirs"`
+	Files   map[string]string            `json:"files"`
+	Regions map[string]map[string]string `json:"regions,omitempty"`
+}
+
+// ManifestPath is where the manifest of cfg is written, relative to the
+// output directory.
+func ManifestPath(cfg *types.Config) string {
+	return path.Join(cfg.ProjectName, ManifestName)
+}
+
+// NewManifest records the files and directories in generated. Config is
+// the hash of cfg after includes are merged.
+func NewManifest(cfg *types.Config, generated *output.MemorySink) (*Manifest, error) {
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Config: hash(config),
+		Dirs:   generated.Dirs(),
+		Files:  map[string]string{},
+	}
+	for _, name := range generated.Files() {
+		data, _ := generated.File(name)
+		m.Files[name] = hash(data)
+	}
+	return m, nil
+}
+
+// ReadManifest loads the manifest of cfg below root. It returns nil
+// without error when nothing has been generated there yet.
+func ReadManifest(root string, cfg *types.Config) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(ManifestPath(cfg))))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteManifest saves m as the manifest of cfg below root.
+func WriteManifest(root string, cfg *types.Config, m *Manifest) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, filepath.FromSlash(ManifestPath(cfg))), data, 0644)
+}
+
+// Marshal encodes m as indented JSON with sorted keys.
+func (m *Manifest) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Names returns the recorded files in sorted order.
+func (m *Manifest) Names() []string {
+	names := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Orphans returns the files m records that current no longer generates.
+func (m *Manifest) Orphans(current *Manifest) []string {
+	var orphans []string
+	for _, name := range m.Names() {
+		if _, ok := current.Files[name]; !ok {
+			orphans = append(orphans, name)
+		}
+	}
+	return orphans
+}
+
+// Edited reports whether body, the body of region in the file name, is
+// not the stub m recorded for it. Without a recorded stub, as in a nil
+// manifest, any body counts as edited.
+func (m *Manifest) Edited(name, region, body string) bool {
+	if m == nil {
+		return true
+	}
+	stub, ok := m.Regions[name][region]
+	return !ok || stub != hash([]byte(body))
+}
+
+// Carry copies the recorded hashes of names, and of their region stubs,
+// from previous into m, for files no longer generated but left on disk.
+func (m *Manifest) Carry(previous *Manifest, names []string) {
+	for _, name := range names {
+		m.Files[name] = previous.Files[name]
+		if stubs, ok := previous.Regions[name]; ok {
+			if m.Regions == nil {
+				m.Regions = map[string]map[string]string{}
+			}
+			m.Regions[name] = stubs
+		}
+	}
+}
+
+// FileState is how a recorded file compares with the one on disk.
+type FileState int
+
+const (
+	Unchanged FileState = iota // as generated
+	Edited                     // changed since it was generated
+	Missing                    // no longer on disk
+)
+
+// State compares the file name below root with its recorded hash. A file
+// whose protected regions hold anything but their stubs is edited too,
+// even when it is as written: it may carry code over from earlier runs.
+func (m *Manifest) State(root, name string) (FileState, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Missing, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if hash(data) != m.Files[name] {
+		return Edited, nil
+	}
+	for region, body := range regions.Extract(string(data)) {
+		if m.Edited(name, region, body) {
+			return Edited, nil
+		}
+	}
+	return Unchanged, nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
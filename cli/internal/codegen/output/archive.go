@@ -0,0 +1,107 @@
+package output
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveSink is a Sink that must be closed to finish its output.
+type ArchiveSink interface {
+	Sink
+	io.Closer
+}
+
+// NewArchiveSink returns a sink writing a "zip" or "tar" archive to w.
+func NewArchiveSink(format string, w io.Writer) (ArchiveSink, error) {
+	switch format {
+	case "zip":
+		return NewZipSink(w), nil
+	case "tar":
+		return NewTarSink(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+// ZipSink streams files into a zip archive. Close must be called to
+// finish the archive.
+type ZipSink struct {
+	w *zip.Writer
+}
+
+func NewZipSink(w io.Writer) *ZipSink {
+	return &ZipSink{w: zip.NewWriter(w)}
+}
+
+func (s *ZipSink) WriteFile(name string, data []byte) error {
+	f, err := s.w.CreateHeader(&zip.FileHeader{
+		Name:     path.Clean(name),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func (s *ZipSink) MkdirAll(name string) error {
+	_, err := s.w.CreateHeader(&zip.FileHeader{
+		Name:     dirName(name),
+		Modified: time.Now(),
+	})
+	return err
+}
+
+func (s *ZipSink) Close() error {
+	return s.w.Close()
+}
+
+// TarSink streams files into a tar archive. Close must be called to
+// finish the archive.
+type TarSink struct {
+	w *tar.Writer
+}
+
+func NewTarSink(w io.Writer) *TarSink {
+	return &TarSink{w: tar.NewWriter(w)}
+}
+
+func (s *TarSink) WriteFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Clean(name),
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := s.w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := s.w.Write(data)
+	return err
+}
+
+func (s *TarSink) MkdirAll(name string) error {
+	return s.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dirName(name),
+		Mode:     0755,
+		ModTime:  time.Now(),
+	})
+}
+
+func (s *TarSink) Close() error {
+	return s.w.Close()
+}
+
+// dirName is the archive entry name of a directory.
+func dirName(name string) string {
+	return strings.TrimSuffix(path.Clean(name), "/") + "/"
+}
@@ -0,0 +1,31 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DirSink writes files below a directory on the real filesystem.
+type DirSink struct {
+	root string
+}
+
+func NewDirSink(root string) *DirSink {
+	return &DirSink{root: root}
+}
+
+func (s *DirSink) WriteFile(name string, data []byte) error {
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *DirSink) MkdirAll(name string) error {
+	return os.MkdirAll(s.path(name), 0755)
+}
+
+func (s *DirSink) path(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"path"
+	"sort"
+	"sync"
+)
+
+// MemorySink keeps generated files in memory.
+type MemorySink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{},
+	}
+}
+
+func (s *MemorySink) WriteFile(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path.Clean(name)] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemorySink) MkdirAll(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs[path.Clean(name)] = true
+	return nil
+}
+
+// Files returns the names of all written files in sorted order.
+func (s *MemorySink) Files() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dirs returns the names of all recorded directories in sorted order.
+func (s *MemorySink) Dirs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.dirs))
+	for name := range s.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// File returns the contents written under name.
+func (s *MemorySink) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[path.Clean(name)]
+	return data, ok
+}
+
+// CopyTo writes every recorded directory and file into dst.
+func (s *MemorySink) CopyTo(dst Sink) error {
+	for _, dir := range s.Dirs() {
+		if err := dst.MkdirAll(dir); err != nil {
+			return err
+		}
+	}
+	for _, name := range s.Files() {
+		data, _ := s.File(name)
+		if err := dst.WriteFile(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
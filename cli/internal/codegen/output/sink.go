@@ -0,0 +1,11 @@
+// Package output provides the destinations generated files are written to.
+package output
+
+// Sink receives generated files. Names are slash-separated and relative
+// to the root of the sink.
+type Sink interface {
+	// WriteFile stores data under name, creating parent directories as needed.
+	WriteFile(name string, data []byte) error
+	// MkdirAll records an (possibly empty) directory.
+	MkdirAll(name string) error
+}
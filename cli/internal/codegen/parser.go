@@ -1,25 +1,15 @@
 package codegen
 
 import (
-	"os"
-
-	"github.com/goccy/go-yaml"
 	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
 )
 
+// ParseConfig reads filename and the files it includes, merges them into
+// a single config and validates it.
 func ParseConfig(filename string) (*types.Config, error) {
-	data, err := os.ReadFile(filename)
+	sources, err := loadSources(filename)
 	if err != nil {
 		return nil, err
 	}
-
-	config := &types.Config{
-		Language: "C", // Default language
-	}
-
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, err
-	}
-
-	return config, nil
+	return validateSources(sources)
 }
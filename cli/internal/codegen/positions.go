@@ -0,0 +1,111 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// position is a 1-based line and column in a YAML source.
+type position struct {
+	Line   int
+	Column int
+}
+
+// positions maps YAML paths such as "$.types[0].fields[1].type" to where
+// their value starts in the source, so diagnostics can point at it.
+type positions map[string]position
+
+func indexPositions(data []byte) (positions, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	index := positions{}
+	for _, doc := range file.Docs {
+		index.walk("$", doc.Body)
+	}
+	return index, nil
+}
+
+func (p positions) walk(path string, node ast.Node) {
+	if node == nil {
+		return
+	}
+	if _, seen := p[path]; !seen {
+		if pos, ok := nodePosition(node); ok {
+			p[path] = pos
+		}
+	}
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			p.walkValue(path, value)
+		}
+	case *ast.MappingValueNode:
+		p.walkValue(path, n)
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			p.walk(fmt.Sprintf("%s[%d]", path, i), value)
+		}
+	}
+}
+
+func (p positions) walkValue(path string, mv *ast.MappingValueNode) {
+	key := mv.Key.GetToken()
+	if key == nil {
+		return
+	}
+	child := path + "." + key.Value
+	if key.Position != nil {
+		// Point at the key; nested values refine this below
+		p[child] = position{Line: key.Position.Line, Column: key.Position.Column}
+	}
+	switch mv.Value.(type) {
+	case *ast.MappingNode, *ast.SequenceNode, *ast.MappingValueNode:
+		p.walk(child, mv.Value)
+	default:
+		if tok := mv.Value.GetToken(); tok != nil && tok.Position != nil {
+			p[child] = position{Line: tok.Position.Line, Column: tok.Position.Column}
+		}
+	}
+}
+
+// nodePosition is where node starts: the first key of a block mapping,
+// otherwise the node's own token.
+func nodePosition(node ast.Node) (position, bool) {
+	if m, ok := node.(*ast.MappingNode); ok && len(m.Values) > 0 {
+		node = m.Values[0].Key
+	}
+	tok := node.GetToken()
+	if tok == nil || tok.Position == nil {
+		return position{}, false
+	}
+	return position{Line: tok.Position.Line, Column: tok.Position.Column}, true
+}
+
+// lookup returns the position of path, or of its closest ancestor
+// present in the source when path itself is missing.
+func (p positions) lookup(path string) position {
+	for {
+		if pos, ok := p[path]; ok {
+			return pos
+		}
+		i := lastSeparator(path)
+		if i < 0 {
+			return position{Line: 1, Column: 1}
+		}
+		path = path[:i]
+	}
+}
+
+func lastSeparator(path string) int {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '.' || path[i] == '[' {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,79 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/output"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/regions"
+)
+
+// preservingSink carries the protected regions of the files already
+// below root over into every file written through it. Unless force is
+// set, it fails rather than drop a region that is no longer generated
+// and holds code other than the stub manifest recorded for it.
+type preservingSink struct {
+	output.Sink
+	root     string
+	manifest *Manifest
+	force    bool
+}
+
+func (s *preservingSink) WriteFile(name string, data []byte) error {
+	existing, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(name)))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		merged, dropped := regions.Merge(string(data), string(existing))
+		if edited := s.edited(name, existing, dropped); len(edited) > 0 && !s.force {
+			return fmt.Errorf("%s: protected region(s) %s are no longer generated; move their code or use -force to discard it",
+				name, strings.Join(edited, ", "))
+		}
+		data = []byte(merged)
+	}
+	return s.Sink.WriteFile(name, data)
+}
+
+// edited returns the regions among dropped whose bodies in data differ
+// from the stubs manifest recorded for name.
+func (s *preservingSink) edited(name string, data []byte, dropped []string) []string {
+	if len(dropped) == 0 {
+		return nil
+	}
+	bodies := regions.Extract(string(data))
+	var edited []string
+	for _, region := range dropped {
+		if s.manifest.Edited(name, region, bodies[region]) {
+			edited = append(edited, region)
+		}
+	}
+	return edited
+}
+
+// stubSink records the hash of the generated body of every protected
+// region written through it, before any hand-written code replaces it.
+type stubSink struct {
+	output.Sink
+	mu    sync.Mutex
+	stubs map[string]map[string]string
+}
+
+func (s *stubSink) WriteFile(name string, data []byte) error {
+	if bodies := regions.Extract(string(data)); len(bodies) > 0 {
+		stubs := map[string]string{}
+		for region, body := range bodies {
+			stubs[region] = hash([]byte(body))
+		}
+		s.mu.Lock()
+		s.stubs[name] = stubs
+		s.mu.Unlock()
+	}
+	return s.Sink.WriteFile(name, data)
+}
@@ -0,0 +1,120 @@
+// Package regions keeps hand-written code across regeneration.
+//
+// Generated stubs wrap every body in a protected region:
+//
+//	// user code begin: Person.getName
+//	return "";
+//	// user code end: Person.getName
+//
+// Python uses "#" instead of "//". Regions are keyed by name (the type and
+// method, or the function), so their contents survive signature changes.
+package regions
+
+import "strings"
+
+const (
+	beginMarker = "user code begin:"
+	endMarker   = "user code end:"
+)
+
+// Extract returns the body of every protected region in text keyed by
+// region name. The body is the text between the marker lines.
+func Extract(text string) map[string]string {
+	bodies := map[string]string{}
+	lines := strings.SplitAfter(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		name, ok := marker(lines[i], beginMarker)
+		if !ok {
+			continue
+		}
+		var body strings.Builder
+		for i++; i < len(lines); i++ {
+			if end, ok := marker(lines[i], endMarker); ok && end == name {
+				bodies[name] = body.String()
+				break
+			}
+			body.WriteString(lines[i])
+		}
+	}
+	return bodies
+}
+
+// Merge replaces the body of every region in generated with the body of
+// the region of the same name in existing. Regions existing does not have
+// keep their generated body. It also returns, in order, the names of the
+// regions in existing that generated no longer has, whose bodies are lost.
+func Merge(generated, existing string) (string, []string) {
+	bodies := Extract(existing)
+	if len(bodies) == 0 {
+		return generated, nil
+	}
+
+	var sb strings.Builder
+	merged := map[string]bool{}
+	lines := strings.SplitAfter(generated, "\n")
+	for i := 0; i < len(lines); i++ {
+		sb.WriteString(lines[i])
+		name, ok := marker(lines[i], beginMarker)
+		if !ok {
+			continue
+		}
+		body, keep := bodies[name]
+
+		// Copy or skip the generated body up to the matching end marker
+		j := i + 1
+		for ; j < len(lines); j++ {
+			if end, ok := marker(lines[j], endMarker); ok && end == name {
+				break
+			}
+		}
+		if j == len(lines) {
+			continue // unterminated, leave as generated
+		}
+		if keep {
+			sb.WriteString(body)
+			merged[name] = true
+		} else {
+			sb.WriteString(strings.Join(lines[i+1:j], ""))
+		}
+		i = j - 1
+	}
+
+	var dropped []string
+	for _, name := range names(existing) {
+		if _, ok := bodies[name]; ok && !merged[name] {
+			dropped = append(dropped, name)
+			merged[name] = true // report each name once
+		}
+	}
+	return sb.String(), dropped
+}
+
+// names returns the names of the regions begun in text, in order.
+func names(text string) []string {
+	var names []string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if name, ok := marker(line, beginMarker); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// marker reports whether line is a comment holding kind and returns the
+// region name that follows it.
+func marker(line, kind string) (string, bool) {
+	text := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(text, "//"):
+		text = strings.TrimPrefix(text, "//")
+	case strings.HasPrefix(text, "#"):
+		text = strings.TrimPrefix(text, "#")
+	default:
+		return "", false
+	}
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, kind) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(text, kind)), true
+}
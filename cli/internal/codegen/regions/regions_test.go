@@ -0,0 +1,123 @@
+package regions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]string
+	}{
+		{
+			name: "none",
+			text: "int f() {\n    return 0;\n}\n",
+			want: map[string]string{},
+		},
+		{
+			name: "two regions",
+			text: "// user code begin: A.f\nreturn 1;\n// user code end: A.f\n" +
+				"    # user code begin: g\n    pass\n    # user code end: g\n",
+			want: map[string]string{"A.f": "return 1;\n", "g": "    pass\n"},
+		},
+		{
+			name: "empty body",
+			text: "// user code begin: f\n// user code end: f\n",
+			want: map[string]string{"f": ""},
+		},
+		{
+			name: "unterminated",
+			text: "// user code begin: f\nreturn 1;\n// user code end: g\n",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Extract(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	const (
+		stubF = "// user code begin: f\nreturn 0;\n// user code end: f\n"
+		stubG = "// user code begin: g\nreturn 0;\n// user code end: g\n"
+		stubH = "// user code begin: h\nreturn 0;\n// user code end: h\n"
+		userF = "// user code begin: f\nreturn 1;\n// user code end: f\n"
+		userG = "// user code begin: g\nreturn 2;\n// user code end: g\n"
+	)
+	tests := []struct {
+		name        string
+		generated   string
+		existing    string
+		want        string
+		wantDropped []string
+	}{
+		{
+			name:      "no existing regions",
+			generated: stubF,
+			existing:  "old\n",
+			want:      stubF,
+		},
+		{
+			name:      "kept",
+			generated: "int f() {\n" + stubF + "}\n",
+			existing:  "long f() {\n" + userF + "}\n",
+			want:      "int f() {\n" + userF + "}\n",
+		},
+		{
+			name:      "added",
+			generated: stubF + stubH,
+			existing:  userF,
+			want:      userF + stubH,
+		},
+		{
+			name:        "removed",
+			generated:   stubF,
+			existing:    userF + userG,
+			want:        userF,
+			wantDropped: []string{"g"},
+		},
+		{
+			name:        "renamed",
+			generated:   stubH,
+			existing:    userF + userG,
+			want:        stubH,
+			wantDropped: []string{"f", "g"},
+		},
+		{
+			name:      "reordered",
+			generated: stubG + stubF,
+			existing:  userF + userG,
+			want:      userG + userF,
+		},
+		{
+			name:        "unterminated in generated",
+			generated:   "// user code begin: f\nreturn 0;\n",
+			existing:    userF,
+			want:        "// user code begin: f\nreturn 0;\n",
+			wantDropped: []string{"f"},
+		},
+		{
+			name:      "unterminated in existing",
+			generated: stubF,
+			existing:  "// user code begin: f\nreturn 1;\n",
+			want:      stubF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped := Merge(tt.generated, tt.existing)
+			if got != tt.want {
+				t.Errorf("Merge() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("Merge() dropped %q, want %q", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
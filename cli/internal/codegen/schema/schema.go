@@ -0,0 +1,191 @@
+// Package schema derives a JSON Schema for config.yaml from types.Config,
+// so editors with YAML schema support can complete and check configs.
+//
+// Point an editor at it with a modeline at the top of config.yaml:
+//
+//	# yaml-language-server: $schema=./config.schema.json
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/languages"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// Schema is a JSON Schema (draft-07) node.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Examples             []string           `json:"examples,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // bool or *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// Config returns the schema of types.Config.
+func Config() *Schema {
+	defs := map[string]*Schema{}
+	root := &Schema{
+		Schema:      "http://json-schema.org/draft-07/schema#",
+		Title:       "melke code generator config",
+		Definitions: defs,
+	}
+	body := structSchema(reflect.TypeOf(types.Config{}), defs)
+	root.Type = body.Type
+	root.Properties = body.Properties
+	root.Required = body.Required
+	root.AdditionalProperties = body.AdditionalProperties
+	return root
+}
+
+// JSON renders the schema of types.Config as indented JSON.
+func JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Config(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func typeSchema(t reflect.Type, defs map[string]*Schema) *Schema {
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // guard against recursive types
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return &Schema{Ref: "#/definitions/" + t.Name()}
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), defs)}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer"}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+func structSchema(t reflect.Type, defs map[string]*Schema) *Schema {
+	s := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		prop := typeSchema(field.Type, defs)
+		for _, opt := range strings.Split(field.Tag.Get("schema"), ",") {
+			switch opt {
+			case "required":
+				s.Required = append(s.Required, name)
+			case "language":
+				if field.Type.Kind() == reflect.Slice {
+					prop = &Schema{Type: "array", Items: languageSchema()}
+				} else {
+					prop = languageSchema()
+				}
+			case "package":
+				prop = &Schema{Type: "string", Enum: []string{languages.PackagePath, languages.PackageFlat}}
+			case "enumValue":
+				prop = &Schema{AnyOf: []*Schema{{Type: "integer"}, {Type: "string"}}}
+			case "literal":
+				prop = &Schema{AnyOf: []*Schema{{Type: "number"}, {Type: "string"}, {Type: "boolean"}}}
+			case "access":
+				prop = anyCase([]string{"public", "protected", "private"})
+			case "type":
+				prop = typeNameSchema()
+			}
+		}
+		if doc := field.Tag.Get("doc"); doc != "" {
+			if prop.Ref != "" {
+				// Siblings of $ref are ignored in draft-07
+				prop = &Schema{AnyOf: []*Schema{prop}}
+			}
+			prop.Description = doc
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
+
+// languageSchema offers the registered backend names for completion
+// while accepting them in any case, as the generator does.
+func languageSchema() *Schema {
+	var names []string
+	for _, b := range languages.Backends() {
+		names = append(names, b.Name)
+		names = append(names, b.Aliases...)
+	}
+	sort.Strings(names)
+	return anyCase(names)
+}
+
+// anyCase offers names for completion while accepting them in any case.
+func anyCase(names []string) *Schema {
+	alternatives := make([]string, len(names))
+	for i, name := range names {
+		alternatives[i] = caseInsensitive(name)
+	}
+	return &Schema{
+		AnyOf: []*Schema{
+			{Type: "string", Enum: names},
+			{Type: "string", Pattern: "^(" + strings.Join(alternatives, "|") + ")$"},
+		},
+	}
+}
+
+// typeNameSchema suggests the built-in type names; any other non-empty
+// type expression is accepted and checked by the validator.
+func typeNameSchema() *Schema {
+	return &Schema{
+		AnyOf: []*Schema{
+			{Type: "string", Enum: []string{
+				"bool", "char", "int", "long", "float", "double", "string", "void",
+				"int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "size_t",
+			}},
+			{
+				Type:     "string",
+				Pattern:  `\S`,
+				Examples: []string{"list<int>", "map<string, int>", "optional<string>", "int[4]", "Type*", "const Type&"},
+			},
+		},
+	}
+}
+
+// caseInsensitive turns s into a regular expression matching it in any
+// case, escaping regex metacharacters.
+func caseInsensitive(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		lower, upper := strings.ToLower(string(r)), strings.ToUpper(string(r))
+		switch {
+		case lower != upper:
+			sb.WriteString("[" + lower + upper + "]")
+		case strings.ContainsRune(`\^$.|?*+()[]{}`, r):
+			sb.WriteString(`\` + string(r))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -1,38 +1,210 @@
 package types
 
-// Config represents the structure of the YAML configuration file
+import "strings"
+
+// Config represents the structure of the YAML configuration file.
+//
+// The doc and schema tags feed the JSON Schema produced by the schema
+// package: doc is the description shown by editors, schema lists
+// "required" and the kind of string a field holds ("language", "access"
+// or "type").
 type Config struct {
-	Language    string       `yaml:"language"`
-	ProjectName string       `yaml:"projectName"`
-	Types       []TypeConfig `yaml:"types"`
-	Files       []FileConfig `yaml:"files"`
+	Language    string            `yaml:"language" doc:"Target language; defaults to C." schema:"language"`
+	Languages   []string          `yaml:"languages" doc:"Several target languages, each generated into its own subdirectory of projectName. Replaces language." schema:"language"`
+	ProjectName string            `yaml:"projectName" doc:"Project name, used as the output directory and package name." schema:"required"`
+	Include     []string          `yaml:"include" doc:"Config files whose types and files are merged into this one, relative to this file."`
+	Types       []TypeConfig      `yaml:"types" doc:"Record types with fields and methods."`
+	Interfaces  []InterfaceConfig `yaml:"interfaces" doc:"Interfaces: method signatures types can implement."`
+	Enums       []EnumConfig      `yaml:"enums" doc:"Enumerations, usable as types like record types."`
+	Errors      []ErrorConfig     `yaml:"errors" doc:"Errors functions can throw, declared in the first file."`
+	Aliases     []AliasConfig     `yaml:"aliases" doc:"Other names for types, usable wherever a type is."`
+	Files       []FileConfig      `yaml:"files" doc:"Generated files and their free functions."`
+
+	Layout map[string]LayoutConfig `yaml:"layout" doc:"Output directories per language, keyed by language name."`
+}
+
+// LayoutConfig places one language's output. Every path is relative and
+// empty fields keep the language's default.
+type LayoutConfig struct {
+	Root    string `yaml:"root" doc:"Directory of the language's output, relative to the output directory. Defaults to projectName, plus the language name when languages lists several."`
+	Source  string `yaml:"source" doc:"Directory of source files, relative to root. Defaults to source/src, or source/src/main/java for Java."`
+	Include string `yaml:"include" doc:"Directory of header files, relative to root; C and C++ only. Defaults to source/include."`
+	Package string `yaml:"package" doc:"Java only: path nests sources in a directory per package component, flat puts them directly in source. Defaults to path." schema:"package"`
 }
 
 type TypeConfig struct {
-	Name    string           `yaml:"name"`
-	Fields  []FieldConfig    `yaml:"fields"`
-	Methods []FunctionConfig `yaml:"methods"`
+	Name        string            `yaml:"name" doc:"Type name." schema:"required"`
+	Description string            `yaml:"description" doc:"Documentation of the type, rendered as its doc comment."`
+	Extends     string            `yaml:"extends" doc:"Base type this type inherits fields and methods from."`
+	Implements  []string          `yaml:"implements" doc:"Interfaces this type implements: entries of interfaces, or abstract types without fields whose methods are all abstract. A generic interface takes its type arguments, as in Comparable<Num>."`
+	Abstract    bool              `yaml:"abstract" doc:"Whether the type is abstract; required for types with abstract methods."`
+	TypeParams  []TypeParamConfig `yaml:"typeParams" doc:"Type parameters, making the type generic. Fields and methods refer to them by name."`
+	Fields      []FieldConfig     `yaml:"fields" doc:"Data members."`
+	Methods     []FunctionConfig  `yaml:"methods" doc:"Member functions."`
+
+	Constructors     []ConstructorConfig `yaml:"constructors" doc:"Constructors taking parameters. A constructor without parameters, giving every field its default, is always generated."`
+	FieldConstructor bool                `yaml:"fieldConstructor" doc:"Also generate a constructor with a parameter per field, in field order. Static fields are left out."`
+}
+
+// InterfaceConfig is a pure interface: only the signatures of methods,
+// which types implement. It is read as an abstract type without fields
+// whose methods are all abstract.
+type InterfaceConfig struct {
+	Name        string            `yaml:"name" doc:"Interface name." schema:"required"`
+	Description string            `yaml:"description" doc:"Documentation of the interface."`
+	Extends     string            `yaml:"extends" doc:"Interface this one extends, adding its methods, with its type arguments if it is generic."`
+	TypeParams  []TypeParamConfig `yaml:"typeParams" doc:"Type parameters, making the interface generic. Methods refer to them by name."`
+	Methods     []FunctionConfig  `yaml:"methods" doc:"Method signatures, all public and abstract."`
+}
+
+// ConstructorConfig is a constructor taking parameters. Languages without
+// overloading (C, Go, Python, JavaScript) turn it into a named factory.
+type ConstructorConfig struct {
+	Name        string            `yaml:"name" doc:"Factory name in languages without overloading. Defaults to with followed by the parameter names, e.g. withWidthHeight."`
+	Description string            `yaml:"description" doc:"Documentation of the constructor."`
+	Parameters  []ParameterConfig `yaml:"parameters" doc:"Parameters in order. A parameter named after a field of the type initializes that field." schema:"required"`
+	Access      string            `yaml:"access" doc:"Access level; defaults to public." schema:"access"`
+}
+
+type EnumConfig struct {
+	Name        string            `yaml:"name" doc:"Enum name." schema:"required"`
+	Description string            `yaml:"description" doc:"Documentation of the enum."`
+	Values      []EnumValueConfig `yaml:"values" doc:"Enumerators in order." schema:"required"`
+}
+
+type EnumValueConfig struct {
+	Name        string `yaml:"name" doc:"Enumerator name." schema:"required"`
+	Description string `yaml:"description" doc:"Documentation of the enumerator."`
+	Value       any    `yaml:"value" doc:"Integer or string value. Integers default to one more than the previous enumerator, starting at 0; strings default to the name." schema:"enumValue"`
+}
+
+// ErrorConfig is an entry of the error catalog. Functions list the ones
+// they can fail with under throws.
+type ErrorConfig struct {
+	Name        string `yaml:"name" doc:"Error name, used as is for the exception or error type, e.g. NotFoundError." schema:"required"`
+	Description string `yaml:"description" doc:"Documentation of the error: when functions throw it."`
+	Message     string `yaml:"message" doc:"Default message of the error. Defaults to the description, or else the name."`
+}
+
+// AliasConfig names a type. Java has no aliases: it spells the type
+// itself, and names function types with a functional interface.
+type AliasConfig struct {
+	Name        string `yaml:"name" doc:"Alias name, e.g. UserId." schema:"required"`
+	Description string `yaml:"description" doc:"Documentation of the alias."`
+	Type        string `yaml:"type" doc:"Type the alias stands for, e.g. long, map<string, User> or fn(int) -> bool." schema:"required,type"`
 }
 
 type FieldConfig struct {
-	Name   string `yaml:"name"`
-	Type   string `yaml:"type"`
-	Access string `yaml:"access"`
+	Name        string `yaml:"name" doc:"Field name." schema:"required"`
+	Description string `yaml:"description" doc:"Documentation of the field."`
+	Type        string `yaml:"type" doc:"Field type, e.g. int, string, Rectangle*, list<Point>." schema:"required,type"`
+	Access      string `yaml:"access" doc:"Access level; defaults to private, or public for file variables." schema:"access"`
+	Default     any    `yaml:"default" doc:"Initial value: a number, string or boolean matching the field type, or an enumerator name for enum fields. Defaults to the zero value of the type." schema:"literal"`
+	Static      bool   `yaml:"static" doc:"Fields only: one value shared by every instance of the type."`
+	Const       bool   `yaml:"const" doc:"Constant with the value of default, which it requires. Constant fields are static."`
 }
 
 type FileConfig struct {
-	Name      string           `yaml:"name"`
-	Functions []FunctionConfig `yaml:"functions"`
+	Name        string           `yaml:"name" doc:"File name without extension." schema:"required"`
+	Description string           `yaml:"description" doc:"Documentation of the file, rendered as its file or module comment."`
+	Types       []string         `yaml:"types" doc:"Names of the types, interfaces, enums and aliases declared in this file. Those no file lists go in the first file."`
+	Functions   []FunctionConfig `yaml:"functions" doc:"Free functions declared in the file."`
+	Variables   []FieldConfig    `yaml:"variables" doc:"File-level global variables and, with const, constants."`
 }
 
 type FunctionConfig struct {
-	Name       string            `yaml:"name"`
-	Parameters []ParameterConfig `yaml:"parameters"`
-	ReturnType string            `yaml:"returnType"`
-	Access     string            `yaml:"access"`
+	Name              string            `yaml:"name" doc:"Function name." schema:"required"`
+	Description       string            `yaml:"description" doc:"Documentation of the function."`
+	Parameters        []ParameterConfig `yaml:"parameters" doc:"Parameters in order."`
+	ReturnType        string            `yaml:"returnType" doc:"Return type; omit for void." schema:"type"`
+	ReturnDescription string            `yaml:"returnDescription" doc:"Documentation of the return value."`
+	Access            string            `yaml:"access" doc:"Access level; defaults to public." schema:"access"`
+	TypeParams        []TypeParamConfig `yaml:"typeParams" doc:"Type parameters, making the function generic. Parameters and the return type refer to them by name."`
+	Throws            []string          `yaml:"throws" doc:"Names of the errors the function can fail with, from the errors catalog."`
+	Abstract          bool              `yaml:"abstract" doc:"Methods only: declared without a body, for derived types to implement."`
+	Static            bool              `yaml:"static" doc:"Methods only: called on the type rather than on an instance."`
+}
+
+// TypeParamConfig is a type parameter of a generic type or function.
+type TypeParamConfig struct {
+	Name        string `yaml:"name" doc:"Type parameter name, e.g. T." schema:"required"`
+	Description string `yaml:"description" doc:"Documentation of the type parameter."`
+	Constraint  string `yaml:"constraint" doc:"Type every type argument must derive from or implement; omit to allow any type." schema:"type"`
 }
 
 type ParameterConfig struct {
-	Name string `yaml:"name"`
-	Type string `yaml:"type"`
+	Name        string `yaml:"name" doc:"Parameter name." schema:"required"`
+	Description string `yaml:"description" doc:"Documentation of the parameter."`
+	Type        string `yaml:"type" doc:"Parameter type." schema:"required,type"`
+}
+
+// IsStatic reports whether f is shared by every instance of its type:
+// static fields and constants are.
+func (f FieldConfig) IsStatic() bool {
+	return f.Static || f.Const
+}
+
+// TypeConfig returns i as the abstract type it stands for.
+func (i InterfaceConfig) TypeConfig() TypeConfig {
+	t := TypeConfig{Name: i.Name, Description: i.Description, Extends: i.Extends, Abstract: true, TypeParams: i.TypeParams}
+	for _, m := range i.Methods {
+		m.Abstract = true
+		t.Methods = append(t.Methods, m)
+	}
+	return t
+}
+
+// AllTypes returns the types of c followed by its interfaces.
+func (c *Config) AllTypes() []TypeConfig {
+	all := c.Types[:len(c.Types):len(c.Types)]
+	for _, i := range c.Interfaces {
+		all = append(all, i.TypeConfig())
+	}
+	return all
+}
+
+// ConstructorConfigs returns the constructors of t, followed by the one
+// FieldConstructor asks for.
+func (t TypeConfig) ConstructorConfigs() []ConstructorConfig {
+	ctors := t.Constructors
+	if t.FieldConstructor {
+		ctor := ConstructorConfig{}
+		for _, f := range t.Fields {
+			if f.IsStatic() {
+				continue
+			}
+			ctor.Parameters = append(ctor.Parameters, ParameterConfig{Name: f.Name, Description: f.Description, Type: f.Type})
+		}
+		ctors = append(ctors[:len(ctors):len(ctors)], ctor)
+	}
+	return ctors
+}
+
+// ConstructorName is the name of c, derived from its parameters when the
+// config gives none.
+func (c ConstructorConfig) ConstructorName() string {
+	if c.Name != "" || len(c.Parameters) == 0 {
+		return c.Name
+	}
+	name := "with"
+	for _, p := range c.Parameters {
+		if p.Name != "" {
+			name += strings.ToUpper(p.Name[:1]) + p.Name[1:]
+		}
+	}
+	return name
+}
+
+// DefaultLanguage is generated when neither language nor languages is set.
+const DefaultLanguage = "C"
+
+// Targets returns the languages to generate, in order.
+func (c *Config) Targets() []string {
+	if len(c.Languages) > 0 {
+		return c.Languages
+	}
+	if c.Language == "" {
+		return []string{DefaultLanguage}
+	}
+	return []string{c.Language}
 }
@@ -0,0 +1,1352 @@
+package codegen
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/ir"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/languages"
+	"github.com/kvnbanunu/melke-playground/cli/internal/codegen/types"
+)
+
+// Diagnostic is a problem found in a config, located in its YAML source.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// Diagnostics is the error returned for a config that fails validation.
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i, diag := range d {
+		lines[i] = diag.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator collects every problem in a config in one pass.
+type validator struct {
+	root     *source
+	order    map[string]int // source file -> merge order, for sorting
+	origins  map[string]origin
+	declared map[string]bool
+	diags    Diagnostics
+
+	targets      map[string]bool                    // backend names of the languages generated
+	arity        map[string]int                     // type name -> number of type parameters
+	typeParamsOf map[string][]types.TypeParamConfig // type name -> its type parameters
+	supers       map[string][]string                // type name -> what it extends and implements
+	interfaces   map[string]bool                    // type name -> whether it is an interface
+	typeVars     map[string]string                  // type parameter name -> its constraint
+	bounds       map[string]string                  // type parameter in scope -> its constraint
+	errors       map[string]bool                    // names in the error catalog
+	aliases      map[string]string                  // alias name -> the type it stands for
+	scope        map[string]bool                    // type parameters usable where we are
+	static       map[string]bool                    // type parameters a static member cannot use
+}
+
+// origin is where an entry of the merged config was defined.
+type origin struct {
+	source *source
+	path   string
+}
+
+// Validate checks cfg for problems the YAML decoder cannot catch: missing
+// names, duplicates, unknown access levels and languages, malformed types
+// and references to undefined types. data is the YAML cfg was decoded
+// from and is used to locate each problem; file names it in diagnostics.
+func Validate(cfg *types.Config, file string, data []byte) error {
+	index, err := indexPositions(data)
+	if err != nil {
+		return err
+	}
+	_, err = validateSources([]*source{{file: file, config: cfg, positions: index}})
+	return err
+}
+
+// validateSources merges the types and files of every source into the
+// config of the last one, the root, and validates the result.
+func validateSources(sources []*source) (*types.Config, error) {
+	v := &validator{
+		root:         sources[len(sources)-1],
+		order:        map[string]int{},
+		origins:      map[string]origin{},
+		declared:     map[string]bool{},
+		targets:      map[string]bool{},
+		arity:        map[string]int{},
+		typeParamsOf: map[string][]types.TypeParamConfig{},
+		supers:       map[string][]string{},
+		bounds:       map[string]string{},
+		interfaces:   map[string]bool{},
+		typeVars:     map[string]string{},
+		errors:       map[string]bool{},
+		aliases:      map[string]string{},
+	}
+	for i, src := range sources {
+		v.order[src.file] = i
+	}
+	cfg := v.merge(sources)
+	v.config(cfg)
+	if len(v.diags) == 0 {
+		v.fileCycles(cfg)
+	}
+	if len(v.diags) == 0 {
+		return cfg, nil
+	}
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		a, b := v.diags[i], v.diags[j]
+		if a.File != b.File {
+			return v.order[a.File] < v.order[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return nil, v.diags
+}
+
+// merge concatenates the types, interfaces, enums, errors, aliases and
+// files of sources in order. A definition repeated verbatim in another
+// file is kept once; one that differs is reported as a conflict. Repeats
+// within a single file are left for config to report as duplicates.
+func (v *validator) merge(sources []*source) *types.Config {
+	merged := *v.root.config
+	merged.Types = mergeList(v, sources, "types", "type",
+		func(c *types.Config) []types.TypeConfig { return c.Types },
+		func(t types.TypeConfig) string { return t.Name })
+	merged.Interfaces = mergeList(v, sources, "interfaces", "interface",
+		func(c *types.Config) []types.InterfaceConfig { return c.Interfaces },
+		func(i types.InterfaceConfig) string { return i.Name })
+	merged.Enums = mergeList(v, sources, "enums", "enum",
+		func(c *types.Config) []types.EnumConfig { return c.Enums },
+		func(e types.EnumConfig) string { return e.Name })
+	merged.Errors = mergeList(v, sources, "errors", "error",
+		func(c *types.Config) []types.ErrorConfig { return c.Errors },
+		func(e types.ErrorConfig) string { return e.Name })
+	merged.Aliases = mergeList(v, sources, "aliases", "alias",
+		func(c *types.Config) []types.AliasConfig { return c.Aliases },
+		func(a types.AliasConfig) string { return a.Name })
+	merged.Files = mergeList(v, sources, "files", "file",
+		func(c *types.Config) []types.FileConfig { return c.Files },
+		func(f types.FileConfig) string { return f.Name })
+	return &merged
+}
+
+// mergeList merges the list under key, such as "types", of every source,
+// recording where each merged entry came from.
+func mergeList[T any](v *validator, sources []*source, key, kind string, list func(*types.Config) []T, name func(T) string) []T {
+	var merged []T
+	index := map[string]int{}
+	for _, src := range sources {
+		for i, item := range list(src.config) {
+			local := fmt.Sprintf("$.%s[%d]", key, i)
+			if j, ok := index[name(item)]; ok && v.origins[fmt.Sprintf("$.%s[%d]", key, j)].source != src {
+				if !reflect.DeepEqual(merged[j], item) {
+					v.conflict(src, local, kind, name(item), fmt.Sprintf("$.%s[%d]", key, j))
+				}
+				continue
+			}
+			if name(item) != "" {
+				index[name(item)] = len(merged)
+			}
+			v.origins[fmt.Sprintf("$.%s[%d]", key, len(merged))] = origin{src, local}
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// conflict reports a definition at path in src that differs from the
+// one already merged at prev.
+func (v *validator) conflict(src *source, path, kind, name, prev string) {
+	file, pos := v.locate(prev + ".name")
+	v.report(src.file, src.positions.lookup(path+".name"),
+		fmt.Sprintf("%s %q conflicts with its definition at %s:%d:%d", kind, name, file, pos.Line, pos.Column))
+}
+
+// locate maps a path in the merged config to the file and position it
+// was read from.
+func (v *validator) locate(path string) (string, position) {
+	src, local := v.root, path
+	if i := strings.IndexByte(path, ']'); i >= 0 {
+		if o, ok := v.origins[path[:i+1]]; ok {
+			src, local = o.source, o.path+path[i+1:]
+		}
+	}
+	return src.file, src.positions.lookup(local)
+}
+
+func (v *validator) errorf(path, format string, args ...any) {
+	file, pos := v.locate(path)
+	v.report(file, pos, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) report(file string, pos position, message string) {
+	v.diags = append(v.diags, Diagnostic{
+		File:    file,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Message: message,
+	})
+}
+
+func (v *validator) config(cfg *types.Config) {
+	if strings.TrimSpace(cfg.ProjectName) == "" {
+		v.errorf("$.projectName", "projectName is required")
+	}
+	if cfg.Language != "" && len(cfg.Languages) > 0 {
+		v.errorf("$.languages", "language and languages are mutually exclusive")
+	}
+	if len(cfg.Languages) == 0 {
+		if _, ok := languages.Lookup(cfg.Targets()[0]); !ok {
+			v.errorf("$.language", "unsupported language %q", cfg.Language)
+		}
+	}
+	targets := map[string]bool{}
+	for i, lang := range cfg.Languages {
+		path := fmt.Sprintf("$.languages[%d]", i)
+		backend, ok := languages.Lookup(lang)
+		if !ok {
+			v.errorf(path, "unsupported language %q", lang)
+			continue
+		}
+		if targets[backend.Name] {
+			v.errorf(path, "duplicate language %q", lang)
+		}
+		targets[backend.Name] = true
+	}
+	for _, lang := range cfg.Targets() {
+		if backend, ok := languages.Lookup(lang); ok {
+			v.targets[backend.Name] = true
+		}
+	}
+
+	for i, t := range cfg.AllTypes() {
+		path := typePath(cfg, i)
+		kind := "type"
+		if i >= len(cfg.Types) {
+			kind = "interface"
+		}
+		if !v.name(path, kind, t.Name) {
+			continue
+		}
+		if v.declared[t.Name] {
+			v.errorf(path+".name", "duplicate type %q", t.Name)
+		}
+		v.declared[t.Name] = true
+		v.arity[t.Name] = len(t.TypeParams)
+		v.typeParamsOf[t.Name] = t.TypeParams
+		if t.Extends != "" {
+			v.supers[t.Name] = append(v.supers[t.Name], t.Extends)
+		}
+		v.supers[t.Name] = append(v.supers[t.Name], t.Implements...)
+		v.interfaces[t.Name] = isInterface(t)
+	}
+	for i, in := range cfg.Interfaces {
+		for j, m := range in.Methods {
+			mpath := fmt.Sprintf("$.interfaces[%d].methods[%d]", i, j)
+			if m.Static {
+				v.errorf(mpath+".static", "interface %s cannot have static method %s", in.Name, m.Name)
+			}
+			if accessOf(m.Access) != "public" {
+				v.errorf(mpath+".access", "interface method %s.%s must be public", in.Name, m.Name)
+			}
+		}
+	}
+
+	for i, e := range cfg.Enums {
+		path := fmt.Sprintf("$.enums[%d]", i)
+		if !v.name(path, "enum", e.Name) {
+			continue
+		}
+		if v.declared[e.Name] {
+			v.errorf(path+".name", "duplicate type %q", e.Name)
+		}
+		v.declared[e.Name] = true
+	}
+	for i, e := range cfg.Errors {
+		path := fmt.Sprintf("$.errors[%d]", i)
+		if !v.name(path, "error", e.Name) {
+			continue
+		}
+		if v.declared[e.Name] || v.errors[e.Name] {
+			v.errorf(path+".name", "duplicate type %q", e.Name)
+		}
+		v.errors[e.Name] = true
+	}
+	for i, a := range cfg.Aliases {
+		path := fmt.Sprintf("$.aliases[%d]", i)
+		if !v.name(path, "alias", a.Name) {
+			continue
+		}
+		if v.declared[a.Name] || v.errors[a.Name] {
+			v.errorf(path+".name", "duplicate type %q", a.Name)
+		}
+		v.declared[a.Name] = true
+		v.aliases[a.Name] = a.Type
+	}
+	if len(cfg.Errors) > 0 && v.targets["c"] && v.declared["Status"] {
+		v.errorf("$.errors", "C declares the errors in a Status enum, which clashes with type Status")
+	}
+	enums := map[string]*ir.Enum{}
+	for i, e := range cfg.Enums {
+		v.enum(fmt.Sprintf("$.enums[%d]", i), e)
+		enum := &ir.Enum{Name: e.Name}
+		for _, ev := range e.Values {
+			enum.Values = append(enum.Values, &ir.EnumValue{Name: ev.Name})
+		}
+		enums[e.Name] = enum
+	}
+	cyclic := map[string]bool{}
+	for i, a := range cfg.Aliases {
+		path := fmt.Sprintf("$.aliases[%d]", i)
+		v.alias(path, a)
+		if cyclic[a.Name] {
+			continue // already reported from another alias in the cycle
+		}
+		if chain := v.aliasCycle([]string{a.Name}); chain != nil {
+			for _, name := range chain {
+				cyclic[name] = true
+			}
+			v.errorf(path+".type", "alias cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	v.inheritance(cfg)
+
+	// Types taking part in inheritance dispatch their methods virtually.
+	virtual := map[string]bool{}
+	for _, t := range cfg.AllTypes() {
+		if t.Abstract || t.Extends != "" || len(t.Implements) > 0 {
+			virtual[t.Name] = true
+		}
+		virtual[superName(t.Extends)] = true
+		for _, entry := range t.Implements {
+			virtual[superName(entry)] = true
+		}
+	}
+
+	for i, t := range cfg.AllTypes() {
+		path := typePath(cfg, i)
+		v.scope = v.typeParams(path, t.TypeParams, nil)
+		fields := map[string]bool{}
+		for j, f := range t.Fields {
+			fpath := fmt.Sprintf("%s.fields[%d]", path, j)
+			if v.name(fpath, "field", f.Name) {
+				if fields[f.Name] {
+					v.errorf(fpath+".name", "duplicate field %q in type %s", f.Name, t.Name)
+				}
+				fields[f.Name] = true
+			}
+			v.field(fpath, f, enums)
+		}
+		v.constructors(path, t)
+		v.functions(path+".methods", "method", t.Methods)
+		for j, m := range t.Methods {
+			if len(m.TypeParams) == 0 || m.Static {
+				continue
+			}
+			mpath := fmt.Sprintf("%s.methods[%d].typeParams", path, j)
+			if v.targets["go"] {
+				v.errorf(mpath, "Go methods cannot have type parameters; make %s a function or give %s the type parameters", m.Name, t.Name)
+			}
+			if v.targets["cpp"] && virtual[t.Name] {
+				v.errorf(mpath, "C++ methods with type parameters cannot be virtual, as the methods of %s are", t.Name)
+			}
+		}
+		v.scope = nil
+	}
+
+	v.layout(cfg.Layout)
+
+	files := map[string]bool{}
+	placed := map[string]string{}
+	for i, f := range cfg.Files {
+		path := fmt.Sprintf("$.files[%d]", i)
+		if v.name(path, "file", f.Name) {
+			if files[f.Name] {
+				v.errorf(path+".name", "duplicate file %q", f.Name)
+			}
+			files[f.Name] = true
+		}
+		for j, name := range f.Types {
+			tpath := fmt.Sprintf("%s.types[%d]", path, j)
+			switch other, ok := placed[name]; {
+			case !v.declared[name]:
+				v.errorf(tpath, "undefined type %q", name)
+			case ok:
+				v.errorf(tpath, "type %s is already placed in file %s", name, other)
+			default:
+				placed[name] = f.Name
+			}
+		}
+		vars := map[string]bool{}
+		for j, fv := range f.Variables {
+			vpath := fmt.Sprintf("%s.variables[%d]", path, j)
+			if v.name(vpath, "variable", fv.Name) {
+				if vars[fv.Name] {
+					v.errorf(vpath+".name", "duplicate variable %q in file %s", fv.Name, f.Name)
+				}
+				vars[fv.Name] = true
+			}
+			v.field(vpath, fv, enums)
+		}
+		v.functions(path+".functions", "function", f.Functions)
+	}
+}
+
+// field checks the type, default and access of a field or file variable.
+// Static fields are shared by every instantiation of a generic type, so
+// they cannot use its type parameters.
+func (v *validator) field(path string, f types.FieldConfig, enums map[string]*ir.Enum) {
+	if strings.TrimSpace(f.Type) == "" {
+		v.errorf(path, "field %q has no type", f.Name)
+	} else {
+		scope := v.scope
+		if f.IsStatic() {
+			v.scope, v.static = nil, scope
+		}
+		v.typeRef(path+".type", f.Type)
+		v.scope, v.static = scope, nil
+		v.fieldDefault(path+".default", f, enums)
+	}
+	if f.Const && f.Default == nil {
+		v.errorf(path+".const", "constant %q has no default", f.Name)
+	}
+	v.access(path+".access", f.Access)
+}
+
+// alias checks the type a stands for. C and Java spell a function type
+// by the alias naming it, so that is the one place they allow one, and
+// not inside another type.
+func (v *validator) alias(path string, a types.AliasConfig) {
+	if strings.TrimSpace(a.Type) == "" {
+		v.errorf(path, "alias %q has no type", a.Name)
+		return
+	}
+	t, err := ir.ParseType(a.Type)
+	switch {
+	case err != nil:
+		v.errorf(path+".type", "%v", err)
+	case t.IsVoid():
+		v.errorf(path+".type", "alias %s cannot stand for void", a.Name)
+	case t.IsFunc():
+		for _, part := range append(t.Args, t.Elem) {
+			v.typeRef(path+".type", part.String())
+		}
+	default:
+		v.typeRef(path+".type", a.Type)
+	}
+}
+
+// aliasCycle returns the chain of aliases from chain[0] back to itself,
+// or nil when the types of the aliases from the end of chain never
+// return to it.
+func (v *validator) aliasCycle(chain []string) []string {
+	t, err := ir.ParseType(v.aliases[chain[len(chain)-1]])
+	if err != nil {
+		return nil
+	}
+	var found []string
+	t.Walk(func(r *ir.TypeRef) {
+		if _, ok := v.aliases[r.Name]; !ok || r.Kind != ir.Named || found != nil {
+			return
+		}
+		switch {
+		case r.Name == chain[0]:
+			found = append(chain, r.Name)
+		case !contains(chain, r.Name):
+			found = v.aliasCycle(append(chain[:len(chain):len(chain)], r.Name))
+		}
+	})
+	return found
+}
+
+// fileCycles reports files that use each other's types, directly or
+// through other files. C and C++ headers, Python modules and CommonJS
+// modules cannot include or import each other in a cycle, so a config
+// targeting any of them has to keep its dependencies between files
+// one-way. It builds the model, so it only runs on an otherwise valid
+// config.
+func (v *validator) fileCycles(cfg *types.Config) {
+	var langs []string
+	for _, lang := range []struct{ backend, name string }{
+		{"c", "C"}, {"cpp", "C++"}, {"python", "Python"}, {"javascript", "JavaScript"},
+	} {
+		if v.targets[lang.backend] {
+			langs = append(langs, lang.name)
+		}
+	}
+	if len(langs) == 0 || len(cfg.Files) < 2 {
+		return
+	}
+	m, err := ir.Build(cfg)
+	if err != nil {
+		return
+	}
+	reported := map[*ir.File]bool{}
+	for i, f := range m.Files {
+		if reported[f] {
+			continue
+		}
+		chain := fileCycle([]*ir.File{f})
+		if chain == nil {
+			continue
+		}
+		names := make([]string, len(chain))
+		for j, c := range chain {
+			names[j] = c.Name
+			reported[c] = true
+		}
+		list := langs[0]
+		if n := len(langs); n > 1 {
+			list = strings.Join(langs[:n-1], ", ") + " and " + langs[n-1]
+		}
+		v.errorf(fmt.Sprintf("$.files[%d].name", i),
+			"file cycle: %s; %s cannot include or import files in a cycle, so move the types they share into one file",
+			strings.Join(names, " -> "), list)
+	}
+}
+
+// fileCycle returns the chain of files from chain[0] back to itself, or
+// nil when the dependencies of the file at the end of chain never return
+// to it.
+func fileCycle(chain []*ir.File) []*ir.File {
+	for _, dep := range chain[len(chain)-1].Deps {
+		if dep.File == chain[0] {
+			return append(chain, dep.File)
+		}
+		seen := false
+		for _, f := range chain {
+			seen = seen || f == dep.File
+		}
+		if seen {
+			continue
+		}
+		if found := fileCycle(append(chain[:len(chain):len(chain)], dep.File)); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// typePath is the path of entry i of cfg.AllTypes(): one of the types,
+// or one of the interfaces following them.
+func typePath(cfg *types.Config, i int) string {
+	if i < len(cfg.Types) {
+		return fmt.Sprintf("$.types[%d]", i)
+	}
+	return fmt.Sprintf("$.interfaces[%d]", i-len(cfg.Types))
+}
+
+// hierarchy indexes the types of a config by name for the inheritance
+// checks.
+type hierarchy struct {
+	types map[string]types.TypeConfig
+}
+
+// supertype is a supertype of some type with the type arguments it is
+// given there, keyed by the type parameters they are bound to.
+type supertype struct {
+	types.TypeConfig
+	bindings map[string]*ir.TypeRef
+}
+
+// supers returns the declared supertypes of t: its base, then its
+// interfaces. bindings holds the type arguments of t, which the type
+// arguments of its supertypes can use.
+func (h hierarchy) supers(t types.TypeConfig, bindings map[string]*ir.TypeRef) []supertype {
+	var supers []supertype
+	for _, entry := range append([]string{t.Extends}, t.Implements...) {
+		ref, err := ir.ParseType(entry)
+		if entry == "" || err != nil || ref.Kind != ir.Named {
+			continue
+		}
+		super, ok := h.types[ref.Name]
+		if !ok {
+			continue
+		}
+		ref = substitute(ref, bindings)
+		bound := map[string]*ir.TypeRef{}
+		for i, p := range super.TypeParams {
+			if i < len(ref.Args) {
+				bound[p.Name] = ref.Args[i]
+			}
+		}
+		supers = append(supers, supertype{super, bound})
+	}
+	return supers
+}
+
+// lookup finds the method name in the supertypes of t, depth first, and
+// the type declaring it. The method is spelled with the type arguments
+// t gives that type. seen guards against inheritance cycles.
+func (h hierarchy) lookup(t types.TypeConfig, name string, bindings map[string]*ir.TypeRef, seen map[string]bool) (types.FunctionConfig, string, bool) {
+	for _, super := range h.supers(t, bindings) {
+		if seen[super.Name] {
+			continue
+		}
+		seen[super.Name] = true
+		for _, m := range super.Methods {
+			if m.Name == name {
+				return instantiate(m, super.bindings), super.Name, true
+			}
+		}
+		if m, owner, ok := h.lookup(super.TypeConfig, name, super.bindings, seen); ok {
+			return m, owner, true
+		}
+	}
+	return types.FunctionConfig{}, "", false
+}
+
+// instantiate spells the signature of fn with the type arguments bound
+// to the type parameters of its type.
+func instantiate(fn types.FunctionConfig, bindings map[string]*ir.TypeRef) types.FunctionConfig {
+	if len(bindings) == 0 {
+		return fn
+	}
+	spell := func(s string) string {
+		t, err := ir.ParseType(s)
+		if strings.TrimSpace(s) == "" || err != nil {
+			return s
+		}
+		return substitute(t, bindings).String()
+	}
+	fn.ReturnType = spell(fn.ReturnType)
+	params := make([]types.ParameterConfig, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		p.Type = spell(p.Type)
+		params[i] = p
+	}
+	fn.Parameters = params
+	return fn
+}
+
+// abstract collects the abstract methods t inherits, keyed by name, with
+// the type declaring each.
+func (h hierarchy) abstract(t types.TypeConfig, found map[string]string, seen map[string]bool) {
+	for _, super := range h.supers(t, nil) {
+		if seen[super.Name] {
+			continue
+		}
+		seen[super.Name] = true
+		for _, m := range super.Methods {
+			if _, ok := found[m.Name]; !ok && m.Abstract && !m.Static {
+				found[m.Name] = super.Name
+			}
+		}
+		h.abstract(super.TypeConfig, found, seen)
+	}
+}
+
+// implements reports whether t or its chain of base types has a
+// concrete method called name.
+func (h hierarchy) implements(t types.TypeConfig, name string, seen map[string]bool) bool {
+	for !seen[t.Name] {
+		seen[t.Name] = true
+		for _, m := range t.Methods {
+			if m.Name == name && !m.Abstract && !m.Static {
+				return true
+			}
+		}
+		base, ok := h.types[superName(t.Extends)]
+		if !ok {
+			return false
+		}
+		t = base
+	}
+	return false
+}
+
+// superName is the type an extends or implements entry names, without
+// the type arguments a generic interface is given.
+func superName(entry string) string {
+	if t, err := ir.ParseType(entry); err == nil && t.Kind == ir.Named {
+		return t.Name
+	}
+	return entry
+}
+
+func isInterface(t types.TypeConfig) bool {
+	if !t.Abstract || len(t.Fields) > 0 {
+		return false
+	}
+	for _, m := range t.Methods {
+		if !m.Abstract {
+			return false
+		}
+	}
+	return true
+}
+
+// inheritance checks extends and implements: that they name types of
+// the right kind, that there are no cycles, that only abstract types
+// have abstract methods, that overrides match what they override and
+// that concrete types implement every abstract method they inherit.
+func (v *validator) inheritance(cfg *types.Config) {
+	h := hierarchy{types: map[string]types.TypeConfig{}}
+	for _, t := range cfg.AllTypes() {
+		if _, dup := h.types[t.Name]; !dup && t.Name != "" {
+			h.types[t.Name] = t
+		}
+	}
+	enums := map[string]bool{}
+	for _, e := range cfg.Enums {
+		enums[e.Name] = true
+	}
+	// target resolves an extends or implements entry of owner: the name
+	// of a type, with type arguments for a generic interface, which can
+	// use the type parameters of owner
+	target := func(path, entry string, owner types.TypeConfig) (types.TypeConfig, bool) {
+		ref, err := ir.ParseType(entry)
+		if err != nil {
+			v.errorf(path, "%v", err)
+			return types.TypeConfig{}, false
+		}
+		if ref.Kind != ir.Named || ref.Const {
+			v.errorf(path, "cannot inherit from %s; name a type or interface", entry)
+			return types.TypeConfig{}, false
+		}
+		name := ref.Name
+		t, ok := h.types[name]
+		switch {
+		case ok && len(t.TypeParams) > 0 && !isInterface(t):
+			v.errorf(path, "cannot inherit from generic type %s", name)
+			return t, false
+		case ok:
+			scope := map[string]bool{}
+			for _, p := range owner.TypeParams {
+				scope[p.Name] = true
+				v.bounds[p.Name] = p.Constraint
+			}
+			v.scope = scope
+			v.typeRef(path, entry)
+			v.scope = nil
+		case enums[name]:
+			v.errorf(path, "cannot inherit from enum %s", name)
+		case v.aliases[name] != "":
+			v.errorf(path, "cannot inherit from alias %s; name the type it stands for", name)
+		default:
+			v.errorf(path, "undefined type %q", name)
+		}
+		return t, ok
+	}
+
+	for i, t := range cfg.AllTypes() {
+		path := typePath(cfg, i)
+		if t.Extends != "" {
+			base, ok := target(path+".extends", t.Extends, t)
+			switch {
+			case !ok:
+			case i >= len(cfg.Types) && !isInterface(base):
+				v.errorf(path+".extends", "interface %s can only extend interfaces; %s is not one", t.Name, t.Extends)
+			case isInterface(base) && !isInterface(t):
+				v.errorf(path+".extends", "%s is an interface; list it under implements", t.Extends)
+			}
+		}
+		implemented := map[string]bool{}
+		for j, entry := range t.Implements {
+			ipath := fmt.Sprintf("%s.implements[%d]", path, j)
+			name := superName(entry)
+			if implemented[name] {
+				v.errorf(ipath, "duplicate interface %q in implements of %s", name, t.Name)
+				continue
+			}
+			implemented[name] = true
+			if iface, ok := target(ipath, entry, t); ok && !isInterface(iface) {
+				v.errorf(ipath, "%s is not an interface (an entry of interfaces, or an abstract type with only abstract methods and no fields)", name)
+			}
+		}
+		for j, m := range t.Methods {
+			if m.Abstract && m.Static && i < len(cfg.Types) {
+				v.errorf(fmt.Sprintf("%s.methods[%d].abstract", path, j), "static method %s.%s cannot be abstract", t.Name, m.Name)
+			} else if m.Abstract && !t.Abstract {
+				v.errorf(fmt.Sprintf("%s.methods[%d].abstract", path, j), "abstract method %s in type %s, which is not abstract", m.Name, t.Name)
+			}
+		}
+	}
+
+	cyclic := map[string]bool{}
+	for i, t := range cfg.AllTypes() {
+		if cyclic[t.Name] {
+			continue // already reported from another type in the cycle
+		}
+		if chain := v.cycle(h, t, []string{t.Name}); chain != nil {
+			for _, name := range chain {
+				cyclic[name] = true
+			}
+			v.errorf(typePath(cfg, i)+".name", "inheritance cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	for i, t := range cfg.AllTypes() {
+		if cyclic[t.Name] {
+			continue
+		}
+		path := typePath(cfg, i)
+		for j, m := range t.Methods {
+			over, owner, ok := h.lookup(t, m.Name, nil, map[string]bool{})
+			if !ok {
+				continue
+			}
+			mpath := fmt.Sprintf("%s.methods[%d]", path, j)
+			if m.Static || over.Static {
+				v.errorf(mpath+".name", "method %s.%s clashes with %s.%s, as static methods cannot be overridden", t.Name, m.Name, owner, over.Name)
+				continue
+			}
+			if !sameSignature(m, over) {
+				v.errorf(mpath+".name", "method %s.%s does not match the signature of %s.%s", t.Name, m.Name, owner, over.Name)
+			}
+			if !strings.EqualFold(accessOf(m.Access), accessOf(over.Access)) {
+				v.errorf(mpath+".access", "method %s.%s must be %s like %s.%s", t.Name, m.Name, accessOf(over.Access), owner, over.Name)
+			}
+			if !sameErrors(m.Throws, over.Throws) {
+				v.errorf(mpath+".throws", "method %s.%s must throw the same errors as %s.%s", t.Name, m.Name, owner, over.Name)
+			}
+		}
+
+		if t.Abstract {
+			continue
+		}
+		inherited := map[string]string{}
+		h.abstract(t, inherited, map[string]bool{t.Name: true})
+		names := make([]string, 0, len(inherited))
+		for name := range inherited {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !h.implements(t, name, map[string]bool{}) {
+				v.errorf(path+".name", "type %s does not implement %s.%s", t.Name, inherited[name], name)
+			}
+		}
+	}
+}
+
+// cycle returns the inheritance chain from chain[0] back to itself, or
+// nil when following supertypes from the end of chain never returns.
+func (v *validator) cycle(h hierarchy, t types.TypeConfig, chain []string) []string {
+	for _, super := range h.supers(t, nil) {
+		if super.Name == chain[0] {
+			return append(chain, super.Name)
+		}
+		if contains(chain, super.Name) {
+			continue // a cycle not through chain[0], reported from its own types
+		}
+		if found := v.cycle(h, super.TypeConfig, append(chain, super.Name)); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sameSignature compares parameter and return types after parsing, so
+// spelling differences such as "std::string" and "string" do not count.
+func sameSignature(a, b types.FunctionConfig) bool {
+	if len(a.Parameters) != len(b.Parameters) {
+		return false
+	}
+	if !sameType(a.ReturnType, b.ReturnType) {
+		return false
+	}
+	for i := range a.Parameters {
+		if !sameType(a.Parameters[i].Type, b.Parameters[i].Type) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameErrors(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, name := range a {
+		if !contains(b, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameType(a, b string) bool {
+	ta, errA := ir.ParseType(a)
+	tb, errB := ir.ParseType(b)
+	if errA != nil || errB != nil {
+		return true // reported where the type is declared
+	}
+	return ta.String() == tb.String()
+}
+
+// typeKey spells a type string the same way whichever alias it uses.
+func typeKey(s string) string {
+	if t, err := ir.ParseType(s); err == nil {
+		return t.String()
+	}
+	return s
+}
+
+// accessOf is the effective access of a method.
+func accessOf(access string) string {
+	if access == "" {
+		return "public"
+	}
+	return strings.ToLower(access)
+}
+
+func (v *validator) enum(path string, e types.EnumConfig) {
+	if len(e.Values) == 0 {
+		v.errorf(path, "enum %q has no values", e.Name)
+		return
+	}
+	names := map[string]bool{}
+	kind := "" // "integer" or "string" once a value is given
+	for i, ev := range e.Values {
+		vpath := fmt.Sprintf("%s.values[%d]", path, i)
+		if v.name(vpath, "enum value", ev.Name) {
+			if names[ev.Name] {
+				v.errorf(vpath+".name", "duplicate value %q in enum %s", ev.Name, e.Name)
+			}
+			names[ev.Name] = true
+		}
+		if ev.Value == nil {
+			continue
+		}
+		_, _, isString, err := ir.ParseEnumValue(ev.Value)
+		if err != nil {
+			v.errorf(vpath+".value", "%v", err)
+			continue
+		}
+		valueKind := "integer"
+		if isString {
+			valueKind = "string"
+		}
+		if kind != "" && kind != valueKind {
+			v.errorf(vpath+".value", "enum %s mixes integer and string values", e.Name)
+		}
+		kind = valueKind
+	}
+}
+
+func (v *validator) layout(layouts map[string]types.LayoutConfig) {
+	names := make([]string, 0, len(layouts))
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		path := "$.layout." + name
+		backend, ok := languages.Lookup(name)
+		if !ok {
+			v.errorf(path, "unsupported language %q", name)
+			continue
+		}
+		if seen[backend.Name] {
+			v.errorf(path, "duplicate layout for %s", backend.Name)
+		}
+		seen[backend.Name] = true
+
+		l := layouts[name]
+		v.dir(path+".root", l.Root)
+		v.dir(path+".source", l.Source)
+		v.dir(path+".include", l.Include)
+		if l.Include != "" && backend.Layout.Include == "" {
+			v.errorf(path+".include", "%s does not generate header files", backend.Name)
+		}
+		switch l.Package {
+		case "":
+		case languages.PackagePath, languages.PackageFlat:
+			if backend.Layout.Package == "" {
+				v.errorf(path+".package", "%s does not generate packages", backend.Name)
+			}
+		default:
+			v.errorf(path+".package", "unknown package style %q (want %s or %s)", l.Package, languages.PackagePath, languages.PackageFlat)
+		}
+	}
+}
+
+// dir checks that a layout directory stays inside the output directory.
+func (v *validator) dir(path, dir string) {
+	clean := filepath.ToSlash(filepath.Clean(dir))
+	switch {
+	case dir == "":
+	case filepath.IsAbs(dir) || strings.HasPrefix(clean, "/"):
+		v.errorf(path, "directory %q must be relative", dir)
+	case clean == ".." || strings.HasPrefix(clean, "../"):
+		v.errorf(path, "directory %q is outside the output directory", dir)
+	}
+}
+
+func (v *validator) functions(path, kind string, fns []types.FunctionConfig) {
+	seen := map[string]bool{}
+	for i, fn := range fns {
+		fpath := fmt.Sprintf("%s[%d]", path, i)
+		if v.name(fpath, kind, fn.Name) {
+			if seen[fn.Name] {
+				v.errorf(fpath+".name", "duplicate %s %q", kind, fn.Name)
+			}
+			seen[fn.Name] = true
+		}
+		v.access(fpath+".access", fn.Access)
+		outer := v.scope
+		if fn.Static {
+			// Static methods are not called on an instantiation either
+			v.scope, v.static = nil, outer
+		}
+		v.scope = v.typeParams(fpath, fn.TypeParams, v.scope)
+		v.typeRef(fpath+".returnType", fn.ReturnType)
+		v.params(fpath, kind+" "+fn.Name, fn.Parameters)
+		v.scope, v.static = outer, nil
+		v.throws(fpath, fn)
+	}
+}
+
+// throws checks the errors fn lists against the catalog.
+func (v *validator) throws(path string, fn types.FunctionConfig) {
+	seen := map[string]bool{}
+	for i, name := range fn.Throws {
+		tpath := fmt.Sprintf("%s.throws[%d]", path, i)
+		switch {
+		case !v.errors[name]:
+			v.errorf(tpath, "undefined error %q", name)
+		case seen[name]:
+			v.errorf(tpath, "duplicate error %q", name)
+		}
+		seen[name] = true
+	}
+	if len(fn.Throws) == 0 || !v.targets["c"] || sameType(fn.ReturnType, "void") {
+		return
+	}
+	for i, p := range fn.Parameters {
+		if p.Name == "result" {
+			v.errorf(fmt.Sprintf("%s.parameters[%d].name", path, i), "C passes the value of a function that throws back through a parameter named result")
+		}
+	}
+}
+
+// typeParams checks the type parameters declared at path and returns
+// the ones in scope inside the declaration: those of outer, then params.
+func (v *validator) typeParams(path string, params []types.TypeParamConfig, outer map[string]bool) map[string]bool {
+	if len(params) == 0 {
+		return outer
+	}
+	if v.targets["c"] {
+		v.errorf(path+".typeParams", "C does not support type parameters")
+	}
+	scope := map[string]bool{}
+	for name := range outer {
+		scope[name] = true
+	}
+	seen := map[string]bool{}
+	for i, p := range params {
+		ppath := fmt.Sprintf("%s.typeParams[%d]", path, i)
+		if !v.name(ppath, "type parameter", p.Name) {
+			continue
+		}
+		switch {
+		case seen[p.Name]:
+			v.errorf(ppath+".name", "duplicate type parameter %q", p.Name)
+		case outer[p.Name]:
+			v.errorf(ppath+".name", "type parameter %q shadows a type parameter of the type", p.Name)
+		case v.declared[p.Name]:
+			v.errorf(ppath+".name", "type parameter %q shadows type %s", p.Name, p.Name)
+		}
+		seen[p.Name] = true
+		scope[p.Name] = true
+		v.bounds[p.Name] = p.Constraint
+		if c, ok := v.typeVars[p.Name]; ok && v.targets["python"] && c != p.Constraint {
+			if c == "" {
+				c = "nothing"
+			}
+			v.errorf(ppath, "Python shares one TypeVar per name, but %s is constrained by %s elsewhere", p.Name, c)
+		}
+		if _, ok := v.typeVars[p.Name]; !ok {
+			v.typeVars[p.Name] = p.Constraint
+		}
+	}
+
+	saved := v.scope
+	v.scope = scope
+	for i, p := range params {
+		if strings.TrimSpace(p.Constraint) == "" {
+			continue
+		}
+		cpath := fmt.Sprintf("%s.typeParams[%d].constraint", path, i)
+		t, err := ir.ParseType(p.Constraint)
+		if err != nil {
+			v.errorf(cpath, "%v", err)
+			continue
+		}
+		if _, alias := v.aliases[t.Name]; t.Kind != ir.Named || t.Const || scope[t.Name] || alias {
+			v.errorf(cpath, "constraint %s is not a type or interface", p.Constraint)
+			continue
+		}
+		v.typeRef(cpath, p.Constraint)
+		if c, ok := v.interfaces[t.Name]; ok && v.targets["go"] && !c {
+			v.errorf(cpath, "Go constraints must be interfaces; %s is not one", t.Name)
+		}
+	}
+	v.scope = saved
+	return scope
+}
+
+func (v *validator) params(path, owner string, params []types.ParameterConfig) {
+	seen := map[string]bool{}
+	for i, p := range params {
+		ppath := fmt.Sprintf("%s.parameters[%d]", path, i)
+		if v.name(ppath, "parameter", p.Name) {
+			if seen[p.Name] {
+				v.errorf(ppath+".name", "duplicate parameter %q in %s", p.Name, owner)
+			}
+			seen[p.Name] = true
+		}
+		if strings.TrimSpace(p.Type) == "" {
+			v.errorf(ppath, "parameter %q has no type", p.Name)
+		} else {
+			v.typeRef(ppath+".type", p.Type)
+		}
+	}
+}
+
+// fieldDefault checks that the default of f is a value of its type, or
+// of the type its alias stands for.
+func (v *validator) fieldDefault(path string, f types.FieldConfig, enums map[string]*ir.Enum) {
+	if f.Default == nil {
+		return
+	}
+	t, err := ir.ParseType(f.Type)
+	if err != nil {
+		return // reported with the type
+	}
+	for seen := map[string]bool{}; t.Kind == ir.Named && v.aliases[t.Name] != "" && !seen[t.Name]; {
+		seen[t.Name] = true
+		if t, err = ir.ParseType(v.aliases[t.Name]); err != nil {
+			return // reported with the alias
+		}
+	}
+	if t.Kind == ir.Named {
+		t.Enum = enums[t.Name]
+	}
+	if _, err := ir.ParseLiteral(f.Default, t); err != nil {
+		v.errorf(path, "%v", err)
+	}
+}
+
+// constructors checks the constructors of t, including the one
+// FieldConstructor adds. Their names must be unique among constructors
+// and methods, since Python and JavaScript make them class methods, and
+// their parameter types must differ, since Java and C++ overload them.
+func (v *validator) constructors(path string, t types.TypeConfig) {
+	if isInterface(t) && len(t.ConstructorConfigs()) > 0 {
+		v.errorf(path+".name", "interface %s cannot have constructors", t.Name)
+		return
+	}
+	instance := 0
+	for _, f := range t.Fields {
+		if !f.IsStatic() {
+			instance++
+		}
+	}
+	if t.FieldConstructor && instance == 0 {
+		v.errorf(path+".fieldConstructor", "type %s has no fields for fieldConstructor", t.Name)
+		return
+	}
+
+	names := map[string]string{}
+	for _, m := range t.Methods {
+		names[m.Name] = "method " + m.Name
+	}
+	signatures := map[string]string{"": "the constructor without parameters"}
+	for i, c := range t.ConstructorConfigs() {
+		cpath := fmt.Sprintf("%s.constructors[%d]", path, i)
+		if i == len(t.Constructors) {
+			cpath = path + ".fieldConstructor"
+		}
+		name := c.ConstructorName()
+		if len(c.Parameters) == 0 {
+			v.errorf(cpath, "constructor without parameters is always generated; give it parameters")
+			continue
+		}
+		if prev, ok := names[name]; ok {
+			v.errorf(cpath, "constructor %s clashes with %s", name, prev)
+		}
+		names[name] = "constructor " + name
+
+		var sig []string
+		for _, p := range c.Parameters {
+			sig = append(sig, typeKey(p.Type))
+		}
+		key := strings.Join(sig, ", ")
+		if prev, ok := signatures[key]; ok {
+			v.errorf(cpath, "constructor %s has the same parameter types as %s", name, prev)
+		}
+		signatures[key] = "constructor " + name
+
+		v.access(cpath+".access", c.Access)
+		v.params(cpath, "constructor "+name, c.Parameters)
+		for j, p := range c.Parameters {
+			for _, f := range t.Fields {
+				if f.Name == p.Name && !f.IsStatic() && !sameType(f.Type, p.Type) {
+					v.errorf(fmt.Sprintf("%s.parameters[%d].type", cpath, j), "parameter %q initializes field %s of type %s", p.Name, f.Name, f.Type)
+				}
+			}
+		}
+	}
+}
+
+// name reports an empty name and returns whether the name is usable.
+func (v *validator) name(path, kind, name string) bool {
+	if strings.TrimSpace(name) == "" {
+		v.errorf(path+".name", "%s name is required", kind)
+		return false
+	}
+	return true
+}
+
+func (v *validator) access(path, access string) {
+	switch strings.ToLower(access) {
+	case "", "public", "protected", "private":
+	default:
+		v.errorf(path, "unknown access level %q (want public, protected or private)", access)
+	}
+}
+
+// typeRef checks that s parses and that every named type it uses is
+// declared. Qualified names such as "std::mutex" are taken as external.
+// C and Java need function types to be named by an alias.
+func (v *validator) typeRef(path, s string) {
+	t, err := ir.ParseType(s)
+	if err != nil {
+		v.errorf(path, "%v", err)
+		return
+	}
+	if t.Uses(ir.Func) {
+		for _, lang := range []struct{ backend, name string }{{"c", "C"}, {"java", "Java"}} {
+			if v.targets[lang.backend] {
+				v.errorf(path, "%s needs function types to be named by an alias", lang.name)
+			}
+		}
+	}
+	t.Walk(func(r *ir.TypeRef) {
+		if r.Kind != ir.Named || strings.Contains(r.Name, "::") {
+			return
+		}
+		switch {
+		case v.scope[r.Name]:
+			if len(r.Args) > 0 {
+				v.errorf(path, "type parameter %s takes no type arguments", r.Name)
+			}
+		case v.static[r.Name]:
+			v.errorf(path, "static members cannot use type parameter %s of their type", r.Name)
+		case !v.declared[r.Name]:
+			v.errorf(path, "undefined type %q", r.Name)
+		case len(r.Args) != v.arity[r.Name]:
+			v.errorf(path, "wrong number of type arguments for %s: want %d, got %d", r.Name, v.arity[r.Name], len(r.Args))
+		default:
+			v.typeArgs(path, r)
+		}
+	})
+}
+
+// typeArgs checks that the type arguments of the generic type r satisfy
+// the constraints of its type parameters. A constraint naming the type
+// parameters stands for its instantiation with r's arguments.
+func (v *validator) typeArgs(path string, r *ir.TypeRef) {
+	params := v.typeParamsOf[r.Name]
+	bindings := map[string]*ir.TypeRef{}
+	for i, p := range params {
+		bindings[p.Name] = r.Args[i]
+	}
+	for i, p := range params {
+		if strings.TrimSpace(p.Constraint) == "" {
+			continue
+		}
+		c, err := ir.ParseType(p.Constraint)
+		if err != nil {
+			continue // reported with the declaration
+		}
+		want := substitute(c, bindings)
+		arg := r.Args[i]
+		switch {
+		case !v.satisfies(arg, want, map[string]bool{}):
+			v.errorf(path, "type argument %s of %s does not satisfy the constraint %s of %s", arg, r.Name, want, p.Name)
+		case v.targets["go"] && arg.Kind == ir.Named && v.declared[arg.Name] && !v.interfaces[arg.Name]:
+			// The struct only has the methods through a pointer
+			v.errorf(path, "Go methods have pointer receivers, so type argument %s of %s does not satisfy the constraint %s of %s; pass an interface", arg, r.Name, want, p.Name)
+		}
+	}
+}
+
+// satisfies reports whether arg is want, derives from it, stands for a
+// type that does or is a type parameter constrained by one.
+func (v *validator) satisfies(arg, want *ir.TypeRef, seen map[string]bool) bool {
+	if arg.String() == want.String() {
+		return true
+	}
+	if arg.Kind != ir.Named || arg.Const || seen[arg.Name] {
+		return false
+	}
+	seen[arg.Name] = true
+	if v.scope[arg.Name] {
+		c, err := ir.ParseType(v.bounds[arg.Name])
+		return err == nil && v.satisfies(c, want, seen)
+	}
+	if a, ok := v.aliases[arg.Name]; ok {
+		t, err := ir.ParseType(a)
+		return err == nil && v.satisfies(t, want, seen)
+	}
+	bindings := map[string]*ir.TypeRef{}
+	for i, p := range v.typeParamsOf[arg.Name] {
+		if i < len(arg.Args) {
+			bindings[p.Name] = arg.Args[i]
+		}
+	}
+	for _, super := range v.supers[arg.Name] {
+		t, err := ir.ParseType(super)
+		if err == nil && v.satisfies(substitute(t, bindings), want, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// substitute returns t with every type parameter named in bindings
+// replaced by the type bound to it.
+func substitute(t *ir.TypeRef, bindings map[string]*ir.TypeRef) *ir.TypeRef {
+	if t == nil {
+		return nil
+	}
+	if b, ok := bindings[t.Name]; ok && t.Kind == ir.Named && len(t.Args) == 0 {
+		return b
+	}
+	c := *t
+	c.Key = substitute(t.Key, bindings)
+	c.Elem = substitute(t.Elem, bindings)
+	c.Args = nil
+	for _, arg := range t.Args {
+		c.Args = append(c.Args, substitute(arg, bindings))
+	}
+	return &c
+}
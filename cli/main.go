@@ -1,31 +1,123 @@
 package main
 
 import (
-	"flag"
 	"fmt"
-	"log"
+	"os"
+	"strings"
+)
 
-	"github.com/kvnbanunu/melke-playground/cli/internal/codegen"
+// Exit codes shared by every command.
+const (
+	exitOK      = 0 // success, or nothing differs
+	exitChanged = 1 // diff or dry run found differences
+	exitUsage   = 2 // bad command line
+	exitInvalid = 3 // config failed to parse or validate
+	exitFailed  = 4 // generation or I/O failed
 )
 
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"generate", "Generate code from the config (default)", runGenerate},
+	{"validate", "Check the config and report every problem", runValidate},
+	{"init", "Write a starter config", runInit},
+	{"languages", "List the supported languages and their aliases", runLanguages},
+	{"diff", "Print a unified diff of what generate would change", runDiff},
+	{"clean", "Remove generated files", runClean},
+	{"schema", "Print the JSON Schema of the config", runSchema},
+}
+
 func main() {
-	// Define command line flags
-	configFile := flag.String("config", "config.yaml", "Path to YAML configuration file")
-	flag.Parse()
-
-	// Read and parse the configuration file
-	cfg, err := codegen.ParseConfig(*configFile)
-	if err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	// Without a command, behave like "generate" so existing scripts
+	// calling the tool with flags only keep working
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			usage()
+			return exitOK
+		}
+		name, rest := legacyCommand(args)
+		switch name {
+		case "languages":
+			return runLanguages(nil)
+		case "diff":
+			return runDiff(rest)
+		}
+		return runGenerate(rest)
 	}
 
-	// Create the generator instance
-	generator := codegen.NewGenerator(cfg)
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	if args[0] == "help" {
+		usage()
+		return exitOK
+	}
 
-	// Generate the code
-	if err := generator.Generate(); err != nil {
-		log.Fatalf("Failed to generate code: %v", err)
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage()
+	return exitUsage
+}
+
+// legacyFlags are the boolean flags that picked a mode before the tool
+// had commands, each mapped to the command that replaced it.
+var legacyFlags = map[string]string{
+	"diff":      "diff",
+	"languages": "languages",
+}
+
+// legacyCommand returns the command a flags-only command line asks for
+// through legacyFlags, or "generate", along with the remaining flags.
+// -dry-run is dropped along with -diff, which used to take precedence.
+func legacyCommand(args []string) (string, []string) {
+	name := "generate"
+	var rest []string
+	for _, arg := range args {
+		flagName, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		cmd, ok := legacyFlags[flagName]
+		if !ok || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		if value != "false" && name != "languages" {
+			name = cmd
+		}
 	}
+	if name != "diff" {
+		return name, rest
+	}
+	filtered := rest[:0]
+	for _, arg := range rest {
+		if flagName, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); flagName != "dry-run" {
+			filtered = append(filtered, arg)
+		}
+	}
+	return name, filtered
+}
 
-	fmt.Println("Code generation completed successfully!")
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: melke <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run \"melke <command> -h\" for the flags of a command.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Exit codes:")
+	fmt.Fprintln(os.Stderr, "  0  success, or nothing would change")
+	fmt.Fprintln(os.Stderr, "  1  diff or dry run found differences")
+	fmt.Fprintln(os.Stderr, "  2  bad command line")
+	fmt.Fprintln(os.Stderr, "  3  config failed to parse or validate")
+	fmt.Fprintln(os.Stderr, "  4  generation or I/O failed")
 }